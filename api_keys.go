@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAPIKeyName = 100
+	// Caracteres de la key (despues del prefijo) que se muestran en la lista
+	apiKeyHintLen = 4
+)
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Sin expires_at la key no vence; se revoca a mano
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Hint       string     `json:"hint"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// Solo en la respuesta de POST: despues no se puede volver a ver
+	Key string `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(k database.ApiKey) apiKeyResponse {
+	resp := apiKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		Scopes:    k.Scopes,
+		Hint:      k.Hint,
+		CreatedAt: k.CreatedAt,
+	}
+	if k.LastUsedAt.Valid {
+		resp.LastUsedAt = &k.LastUsedAt.Time
+	}
+	if k.ExpiresAt.Valid {
+		resp.ExpiresAt = &k.ExpiresAt.Time
+	}
+	return resp
+}
+
+// POST /api/keys: crea una API key. La key se devuelve una sola vez; en la DB
+// queda el hash.
+func (cfg *apiConfig) handlerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyName {
+		respondWithError(w, http.StatusBadRequest, "name is required (max 100 characters)")
+		return
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var expiresAt sql.NullTime
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: req.ExpiresAt.UTC(), Valid: true}
+	}
+
+	key, err := auth.MakePrefixedToken(auth.APIKeyPrefix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create API key")
+		return
+	}
+
+	scopeNames := make([]string, len(scopes))
+	for i, s := range scopes {
+		scopeNames[i] = string(s)
+	}
+	dbKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      req.Name,
+		KeyHash:   auth.HashToken(key),
+		Hint:      key[:len(auth.APIKeyPrefix)+apiKeyHintLen],
+		Scopes:    scopeNames,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create API key")
+		return
+	}
+
+	resp := newAPIKeyResponse(dbKey)
+	resp.Key = key
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// GET /api/keys: las keys no revocadas del usuario, sin la key en si
+func (cfg *apiConfig) handlerListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	keys, err := cfg.db.ListUserAPIKeys(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not list API keys")
+		return
+	}
+
+	resp := make([]apiKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, newAPIKeyResponse(k))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// DELETE /api/keys/{keyID}: la key deja de funcionar en el proximo request
+func (cfg *apiConfig) handlerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid keyID")
+		return
+	}
+
+	n, err := cfg.db.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not revoke API key")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
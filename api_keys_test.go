@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+const testAPIKey = "chirpy_ak_0123456789abcdef"
+
+// returnsAPIKey hace que AuthenticateAPIKey encuentre testAPIKey con scopes.
+func returnsAPIKey(f *fakeDB, userID uuid.UUID, scopes string) {
+	f.on("AuthenticateAPIKey", func(args []driver.Value) ([][]driver.Value, error) {
+		if args[0] != auth.HashToken(testAPIKey) {
+			return nil, nil
+		}
+		return [][]driver.Value{{userID.String(), scopes}}, nil
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		auth       string
+		scope      auth.Scope
+		wantStatus int
+	}{
+		{name: "jwt", auth: "jwt", scope: auth.ScopeChirpsWrite, wantStatus: http.StatusOK},
+		{name: "jwt login only", auth: "jwt", scope: loginOnly, wantStatus: http.StatusOK},
+		{name: "api key with scope", auth: "Bearer " + testAPIKey, scope: auth.ScopeChirpsRead, wantStatus: http.StatusOK},
+		{name: "api key without scope", auth: "Bearer " + testAPIKey, scope: auth.ScopeChirpsWrite, wantStatus: http.StatusForbidden},
+		{name: "api key on login only", auth: "Bearer " + testAPIKey, scope: loginOnly, wantStatus: http.StatusForbidden},
+		{name: "unknown or revoked api key", auth: "Bearer chirpy_ak_nope", scope: auth.ScopeChirpsRead, wantStatus: http.StatusUnauthorized},
+		{name: "invalid jwt", auth: "Bearer nope", scope: auth.ScopeChirpsRead, wantStatus: http.StatusUnauthorized},
+		{name: "no header", scope: auth.ScopeChirpsRead, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			returnsAPIKey(f, userID, `{"chirps:read","profile:write"}`)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			switch tc.auth {
+			case "":
+			case "jwt":
+				req.Header.Set("Authorization", bearer(t, userID))
+			default:
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			got, ok := cfg.requireUser(rec, req, tc.scope)
+
+			if tc.wantStatus == http.StatusOK {
+				if !ok || got != userID {
+					t.Fatalf("requireUser = (%v, %v), status %d", got, ok, rec.Code)
+				}
+				return
+			}
+			if ok || rec.Code != tc.wantStatus {
+				t.Errorf("requireUser ok = %v, status = %d, want %d", ok, rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandlerChirpsWithAPIKey(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	returnsAPIKey(f, uuid.New(), `{"chirps:read"}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hi"}`))
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	rec := httptest.NewRecorder()
+	cfg.handlerChirps(rec, req)
+
+	// Una key de solo lectura no postea
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+}
+
+// Email y password solo se cambian con un login: una key con profile:write
+// tomaria la cuenta.
+func TestHandlerUsersUpdateWithAPIKey(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	returnsAPIKey(f, uuid.New(), `{"profile:write"}`)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(`{"email":"evil@example.com","password":"pw"}`))
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	rec := httptest.NewRecorder()
+	cfg.handlerUsersUpdate(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerCreateAPIKey(t *testing.T) {
+	userID := uuid.New()
+	future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name       string
+		body       string
+		auth       string
+		wantStatus int
+	}{
+		{name: "creates", body: `{"name":"bot","scopes":["chirps:write","chirps:read","chirps:write"],"expires_at":"` + future + `"}`, wantStatus: http.StatusCreated},
+		{name: "no expiry", body: `{"name":"bot","scopes":["chirps:read"]}`, wantStatus: http.StatusCreated},
+		{name: "unknown scope", body: `{"name":"bot","scopes":["admin"]}`, wantStatus: http.StatusBadRequest},
+		{name: "no scopes", body: `{"name":"bot","scopes":[]}`, wantStatus: http.StatusBadRequest},
+		{name: "no name", body: `{"name":" ","scopes":["chirps:read"]}`, wantStatus: http.StatusBadRequest},
+		{name: "expired", body: `{"name":"bot","scopes":["chirps:read"],"expires_at":"` + past + `"}`, wantStatus: http.StatusBadRequest},
+		// Con una API key no se crean otras (ni con mas scopes)
+		{name: "with an api key", body: `{"name":"bot","scopes":["chirps:read"]}`, auth: "Bearer " + testAPIKey, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			returnsAPIKey(f, userID, `{"chirps:read","chirps:write","profile:write"}`)
+			f.on("CreateAPIKey", func(args []driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.New().String(), args[0], args[1], args[2], args[3], args[4], time.Now(), nil, args[5], nil}}, nil
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(tc.body))
+			if tc.auth == "" {
+				req.Header.Set("Authorization", bearer(t, userID))
+			} else {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerCreateAPIKey(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusCreated {
+				if len(f.called("CreateAPIKey")) != 0 {
+					t.Error("CreateAPIKey should not run")
+				}
+				return
+			}
+
+			var res apiKeyResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			args := f.called("CreateAPIKey")[0]
+			if !strings.HasPrefix(res.Key, auth.APIKeyPrefix) || args[2] != auth.HashToken(res.Key) || strings.Contains(args[2].(string), res.Key) {
+				t.Errorf("key %q stored as %v", res.Key, args[2])
+			}
+			if args[0] != userID.String() || res.Hint != res.Key[:len(auth.APIKeyPrefix)+4] {
+				t.Errorf("args = %v, hint = %q", args, res.Hint)
+			}
+			if tc.name == "creates" && (args[4] != `{"chirps:read","chirps:write"}` || res.ExpiresAt == nil) {
+				t.Errorf("scopes = %v, expires_at = %v", args[4], res.ExpiresAt)
+			}
+			if tc.name == "no expiry" && (args[5] != nil || res.ExpiresAt != nil) {
+				t.Errorf("expires_at = %v / %v", args[5], res.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestHandlerListAPIKeys(t *testing.T) {
+	userID := uuid.New()
+	keyID := uuid.New()
+	cfg, f := newTestConfig(t)
+	f.returns("ListUserAPIKeys", []driver.Value{keyID.String(), userID.String(), "bot", auth.HashToken(testAPIKey), "chirpy_ak_0123", `{"chirps:read"}`, time.Now(), time.Now(), nil, nil})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
+	req.Header.Set("Authorization", bearer(t, userID))
+	rec := httptest.NewRecorder()
+	cfg.handlerListAPIKeys(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	// Ni la key ni su hash salen en la lista
+	if body := rec.Body.String(); strings.Contains(body, testAPIKey) || strings.Contains(body, auth.HashToken(testAPIKey)) {
+		t.Errorf("list leaks the key: %s", body)
+	}
+	var res []apiKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].ID != keyID || res[0].Hint != "chirpy_ak_0123" || len(res[0].Scopes) != 1 || res[0].LastUsedAt == nil || res[0].ExpiresAt != nil {
+		t.Errorf("keys = %+v", res)
+	}
+}
+
+func TestHandlerRevokeAPIKey(t *testing.T) {
+	userID := uuid.New()
+	keyID := uuid.New()
+
+	for _, tc := range []struct {
+		name       string
+		revoked    bool
+		wantStatus int
+	}{
+		{name: "revokes", revoked: true, wantStatus: http.StatusNoContent},
+		{name: "not found or not yours", wantStatus: http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.revoked {
+				f.returns("RevokeAPIKey", nil)
+			} else {
+				f.returns("RevokeAPIKey")
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/keys/"+keyID.String(), nil)
+			req.SetPathValue("keyID", keyID.String())
+			req.Header.Set("Authorization", bearer(t, userID))
+			rec := httptest.NewRecorder()
+			cfg.handlerRevokeAPIKey(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if args := f.called("RevokeAPIKey")[0]; args[0] != keyID.String() || args[1] != userID.String() {
+				t.Errorf("RevokeAPIKey args = %v", args)
+			}
+		})
+	}
+}
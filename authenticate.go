@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+// loginOnly es para lo que maneja la cuenta (sesiones, 2FA, API keys): pide
+// un access token de login y no acepta API keys, con ningun scope.
+const loginOnly auth.Scope = ""
+
+var (
+	errUnauthenticated  = errors.New("unauthenticated")
+	errMissingScope     = errors.New("missing scope")
+	errAccountSuspended = errors.New("account suspended")
+)
+
+// authenticate valida el bearer del request, que puede ser un access token
+// (JWT) o una API key, y devuelve el usuario. Un JWT de login puede todo; una
+// API key o un token de un cliente OAuth solo lo que cubren sus scopes.
+func (cfg *apiConfig) authenticate(r *http.Request, scope auth.Scope) (uuid.UUID, error) {
+	tokenStr, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, errUnauthenticated
+	}
+
+	if !strings.HasPrefix(tokenStr, auth.APIKeyPrefix) {
+		claims, err := cfg.jwtKeys.ParseJWT(tokenStr)
+		if err != nil {
+			return uuid.Nil, errUnauthenticated
+		}
+		userID := claims.UserID
+		if claims.Delegated() {
+			if userID, err = cfg.authenticateClientToken(r.Context(), claims, scope); err != nil {
+				return uuid.Nil, err
+			}
+		}
+		// El JWT sigue siendo valido hasta que vence: la suspension se mira
+		// en cada request
+		if err := cfg.checkNotSuspended(r.Context(), userID); err != nil {
+			return uuid.Nil, err
+		}
+		return userID, nil
+	}
+
+	if scope == loginOnly {
+		return uuid.Nil, errMissingScope
+	}
+	key, err := cfg.db.AuthenticateAPIKey(r.Context(), auth.HashToken(tokenStr))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, errUnauthenticated
+		}
+		return uuid.Nil, err
+	}
+	if !auth.HasScope(key.Scopes, scope) {
+		return uuid.Nil, errMissingScope
+	}
+	return key.UserID, nil
+}
+
+// requireUser es authenticate para los handlers: si no hay usuario responde
+// 401 (sin credenciales validas) o 403 (la API key no tiene el scope o la
+// cuenta esta suspendida).
+func (cfg *apiConfig) requireUser(w http.ResponseWriter, r *http.Request, scope auth.Scope) (uuid.UUID, bool) {
+	userID, err := cfg.authenticate(r, scope)
+	if err != nil {
+		respondAuthError(w, err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func respondAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		respondWithError(w, http.StatusUnauthorized, "unauthorized")
+	case errors.Is(err, errMissingScope):
+		respondWithError(w, http.StatusForbidden, "insufficient scope")
+	case errors.Is(err, errAccountSuspended):
+		respondWithError(w, http.StatusForbidden, "account suspended")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "could not authenticate")
+	}
+}
+
+// authenticateClientToken chequea un access token emitido a un cliente OAuth:
+// ademas del scope, que la autorizacion no se haya revocado.
+func (cfg *apiConfig) authenticateClientToken(ctx context.Context, claims *auth.Claims, scope auth.Scope) (uuid.UUID, error) {
+	if scope == loginOnly || !auth.HasScope(claims.Scopes(), scope) {
+		return uuid.Nil, errMissingScope
+	}
+	grantID, err := uuid.Parse(claims.GrantID)
+	if err != nil {
+		return uuid.Nil, errUnauthenticated
+	}
+	active, err := cfg.db.IsOAuthGrantActive(ctx, grantID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !active {
+		return uuid.Nil, errUnauthenticated
+	}
+	return claims.UserID, nil
+}
+
+// checkNotSuspended rechaza cuentas suspendidas (errAccountSuspended) o
+// borradas (errUnauthenticated).
+func (cfg *apiConfig) checkNotSuspended(ctx context.Context, userID uuid.UUID) error {
+	suspended, err := cfg.db.IsUserSuspended(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errUnauthenticated
+		}
+		return err
+	}
+	if suspended {
+		return errAccountSuspended
+	}
+	return nil
+}
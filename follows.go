@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// POST /api/users/{userID}/follow
+func (cfg *apiConfig) handlerFollow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, auth.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	followedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid userID")
+		return
+	}
+
+	if followedID == userID {
+		respondWithError(w, http.StatusBadRequest, "cannot follow yourself")
+		return
+	}
+
+	// El usuario a seguir tiene que existir
+	if _, err := cfg.db.GetUserByID(r.Context(), followedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get user")
+		return
+	}
+
+	// Seguir dos veces no es un error
+	err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FollowedID: followedID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not follow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/users/{userID}/follow
+func (cfg *apiConfig) handlerUnfollow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, auth.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	followedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid userID")
+		return
+	}
+
+	err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FollowedID: followedID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/timeline: chirps de las cuentas que sigue el usuario, mas nuevos primero
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.GetTimelineParams{
+		FollowerID: userID,
+		PageLimit:  page.Limit + 1,
+	}
+	if page.Cursor != nil {
+		params.BeforeCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	dbChirps, err := cfg.db.GetTimeline(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get timeline")
+		return
+	}
+
+	res, err := cfg.newChirpsPage(r.Context(), dbChirps, page.Limit, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get timeline")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
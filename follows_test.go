@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerFollow(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		target     string
+		setup      func(f *fakeDB)
+		wantStatus int
+		wantFollow bool
+	}{
+		{name: "invalid id", target: "nope", wantStatus: http.StatusBadRequest},
+		{name: "self", target: me.String(), wantStatus: http.StatusBadRequest},
+		{
+			name:       "unknown user",
+			target:     other.String(),
+			setup:      func(f *fakeDB) { f.returns("GetUserByID") },
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "follow",
+			target: other.String(),
+			setup: func(f *fakeDB) {
+				f.returns("GetUserByID", userRow(database.User{ID: other}))
+				f.returns("FollowUser")
+			},
+			wantStatus: http.StatusNoContent,
+			wantFollow: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/"+tc.target+"/follow", nil)
+			req.SetPathValue("userID", tc.target)
+			req.Header.Set("Authorization", bearer(t, me))
+			rec := httptest.NewRecorder()
+			cfg.handlerFollow(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			follows := f.called("FollowUser")
+			if tc.wantFollow != (len(follows) == 1) {
+				t.Fatalf("FollowUser calls = %d", len(follows))
+			}
+			if tc.wantFollow && (follows[0][0] != me.String() || follows[0][1] != other.String()) {
+				t.Errorf("FollowUser args = %v", follows[0])
+			}
+		})
+	}
+}
+
+func TestHandlerUnfollow(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name         string
+		target       string
+		auth         bool
+		setup        func(f *fakeDB)
+		wantStatus   int
+		wantUnfollow bool
+	}{
+		{name: "no auth", target: other.String(), wantStatus: http.StatusUnauthorized},
+		{name: "invalid id", target: "nope", auth: true, wantStatus: http.StatusBadRequest},
+		{
+			name:         "unfollow",
+			target:       other.String(),
+			auth:         true,
+			setup:        func(f *fakeDB) { f.returns("UnfollowUser", []driver.Value{}) },
+			wantStatus:   http.StatusNoContent,
+			wantUnfollow: true,
+		},
+		{
+			// Dejar de seguir a alguien que no se seguia no es un error
+			name:         "not following",
+			target:       other.String(),
+			auth:         true,
+			setup:        func(f *fakeDB) { f.returns("UnfollowUser") },
+			wantStatus:   http.StatusNoContent,
+			wantUnfollow: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/users/"+tc.target+"/follow", nil)
+			req.SetPathValue("userID", tc.target)
+			if tc.auth {
+				req.Header.Set("Authorization", bearer(t, me))
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerUnfollow(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			unfollows := f.called("UnfollowUser")
+			if tc.wantUnfollow != (len(unfollows) == 1) {
+				t.Fatalf("UnfollowUser calls = %d", len(unfollows))
+			}
+			if tc.wantUnfollow && (unfollows[0][0] != me.String() || unfollows[0][1] != other.String()) {
+				t.Errorf("UnfollowUser args = %v", unfollows[0])
+			}
+		})
+	}
+}
+
+func TestHandlerTimeline(t *testing.T) {
+	me := uuid.New()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var chirps []database.Chirp
+	var rows [][]driver.Value
+	for i := 0; i < 3; i++ {
+		c := database.Chirp{ID: uuid.New(), CreatedAt: base.Add(-time.Duration(i) * time.Minute), Body: "c", UserID: uuid.New()}
+		chirps = append(chirps, c)
+		rows = append(rows, chirpRow(c))
+	}
+	cursor := pageCursor{CreatedAt: chirps[1].CreatedAt, ID: chirps[1].ID}
+
+	tests := []struct {
+		name       string
+		query      string
+		rows       [][]driver.Value
+		wantStatus int
+		wantChirps int
+		wantLimit  driver.Value
+		wantBefore *pageCursor
+		wantNext   *pageCursor
+	}{
+		{
+			// Sin cuentas seguidas la respuesta es una lista vacia, no null
+			name:       "empty follow set",
+			wantStatus: http.StatusOK,
+			wantLimit:  int64(defaultPageLimit + 1),
+		},
+		{
+			name:       "first page",
+			query:      "limit=2",
+			rows:       rows,
+			wantStatus: http.StatusOK,
+			wantChirps: 2,
+			wantLimit:  int64(3),
+			wantNext:   &cursor,
+		},
+		{
+			name:       "last page",
+			query:      "limit=2&cursor=" + encodeCursor(cursor),
+			rows:       rows[2:],
+			wantStatus: http.StatusOK,
+			wantChirps: 1,
+			wantLimit:  int64(3),
+			wantBefore: &cursor,
+		},
+		{name: "bad cursor", query: "cursor=garbage", wantStatus: http.StatusBadRequest},
+		{name: "bad limit", query: "limit=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("GetTimeline", tc.rows...)
+			f.returns("GetChirpStats")
+
+			req := httptest.NewRequest(http.MethodGet, "/api/timeline?"+tc.query, nil)
+			req.Header.Set("Authorization", bearer(t, me))
+			rec := httptest.NewRecorder()
+			cfg.handlerTimeline(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				if n := len(f.called("GetTimeline")); n != 0 {
+					t.Errorf("GetTimeline calls = %d, want 0", n)
+				}
+				return
+			}
+
+			args := f.called("GetTimeline")[0]
+			if args[0] != me.String() {
+				t.Errorf("follower arg = %v, want %v", args[0], me)
+			}
+			if args[3] != tc.wantLimit {
+				t.Errorf("page_limit arg = %v, want %v", args[3], tc.wantLimit)
+			}
+			if tc.wantBefore == nil {
+				if args[1] != nil || args[2] != nil {
+					t.Errorf("before args = %v %v, want nil", args[1], args[2])
+				}
+			} else {
+				before, _ := args[1].(time.Time)
+				if !before.Equal(tc.wantBefore.CreatedAt) || args[2] != tc.wantBefore.ID.String() {
+					t.Errorf("before args = %v %v, want %+v", args[1], args[2], *tc.wantBefore)
+				}
+			}
+
+			var res struct {
+				Chirps     []chirpResponse `json:"chirps"`
+				NextCursor *string         `json:"next_cursor"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Chirps == nil || len(res.Chirps) != tc.wantChirps {
+				t.Fatalf("chirps = %v, want %d", res.Chirps, tc.wantChirps)
+			}
+			if tc.wantNext == nil {
+				if res.NextCursor != nil {
+					t.Errorf("next_cursor = %q, want none", *res.NextCursor)
+				}
+				return
+			}
+			if res.NextCursor == nil {
+				t.Fatal("missing next_cursor")
+			}
+			next, err := decodeCursor(*res.NextCursor)
+			if err != nil {
+				t.Fatalf("next_cursor: %v", err)
+			}
+			if next.ID != tc.wantNext.ID || !next.CreatedAt.Equal(tc.wantNext.CreatedAt) {
+				t.Errorf("next cursor = %+v, want %+v", next, *tc.wantNext)
+			}
+		})
+	}
+}
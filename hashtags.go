@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/chirptext"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
+)
+
+type trendingTag struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+type trendingResponse struct {
+	Window string        `json:"window"`
+	Tags   []trendingTag `json:"tags"`
+}
+
+// GET /api/hashtags/{tag}/chirps: chirps con ese tag, mas nuevos primero
+func (cfg *apiConfig) handlerGetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag, ok := chirptext.NormalizeHashtag(r.PathValue("tag"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "invalid hashtag")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.GetChirpsByHashtagParams{
+		Tag:       tag,
+		PageLimit: page.Limit + 1,
+	}
+	if page.Cursor != nil {
+		params.BeforeCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	dbChirps, err := cfg.db.GetChirpsByHashtag(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get chirps")
+		return
+	}
+
+	res, err := cfg.newChirpsPage(r.Context(), dbChirps, page.Limit, cfg.viewerID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get chirps")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// GET /api/hashtags/trending?window=24h&limit=10
+// Solo se aceptan las ventanas de TRENDING_WINDOWS. El peso de cada uso se
+// reduce a la mitad cada cuarto de ventana.
+func (cfg *apiConfig) handlerTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	window := cfg.trendingWindows[0]
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || !containsDuration(cfg.trendingWindows, d) {
+			allowed := make([]string, 0, len(cfg.trendingWindows))
+			for _, tw := range cfg.trendingWindows {
+				allowed = append(allowed, tw.String())
+			}
+			respondWithError(w, http.StatusBadRequest, "window must be one of: "+strings.Join(allowed, ", "))
+			return
+		}
+		window = d
+	}
+
+	limit, err := parseLimit(r, defaultTrendingLimit, maxTrendingLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := cfg.db.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		HalfLifeSeconds: (window / 4).Seconds(),
+		WindowSeconds:   window.Seconds(),
+		MaxTags:         int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get trending hashtags")
+		return
+	}
+
+	res := trendingResponse{Window: window.String(), Tags: make([]trendingTag, 0, len(rows))}
+	for _, row := range rows {
+		res.Tags = append(res.Tags, trendingTag{Tag: row.Tag, Uses: row.Uses, Score: row.Score})
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func containsDuration(list []time.Duration, d time.Duration) bool {
+	for _, item := range list {
+		if item == d {
+			return true
+		}
+	}
+	return false
+}
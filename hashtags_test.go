@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerChirpsStoresHashtags(t *testing.T) {
+	user := uuid.New()
+	cfg, f := newTestConfig(t)
+
+	var created database.Chirp
+	f.on("CreateChirp", func(args []driver.Value) ([][]driver.Value, error) {
+		created = database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: args[0].(string), UserID: user}
+		return [][]driver.Value{chirpRow(created)}, nil
+	})
+	f.returns("AddChirpHashtags")
+
+	body := strings.NewReader(`{"body":"Probando #Go y #go otra vez, #café"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", body)
+	req.Header.Set("Authorization", bearer(t, user))
+	rec := httptest.NewRecorder()
+	cfg.handlerChirps(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	calls := f.called("AddChirpHashtags")
+	if len(calls) != 1 {
+		t.Fatalf("AddChirpHashtags calls = %v", calls)
+	}
+	if calls[0][0] != created.ID.String() || calls[0][1] != `{"go","café"}` {
+		t.Errorf("AddChirpHashtags args = %v", calls[0])
+	}
+
+	// Sin tags no hace falta tocar chirp_hashtags
+	req = httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"nada que ver aca"}`))
+	req.Header.Set("Authorization", bearer(t, user))
+	rec = httptest.NewRecorder()
+	cfg.handlerChirps(rec, req)
+	if rec.Code != http.StatusCreated || len(f.called("AddChirpHashtags")) != 1 {
+		t.Errorf("status = %d, AddChirpHashtags calls = %d", rec.Code, len(f.called("AddChirpHashtags")))
+	}
+}
+
+func TestHandlerTrendingHashtags(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantWindow   string
+		wantHalfLife float64
+		wantLimit    int64
+	}{
+		{name: "default window", query: "", wantStatus: http.StatusOK, wantWindow: "24h0m0s", wantHalfLife: 6 * 3600, wantLimit: defaultTrendingLimit},
+		{name: "configured window", query: "?window=1h&limit=500", wantStatus: http.StatusOK, wantWindow: "1h0m0s", wantHalfLife: 900, wantLimit: maxTrendingLimit},
+		{name: "unknown window", query: "?window=2h", wantStatus: http.StatusBadRequest},
+		{name: "bad limit", query: "?limit=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("GetTrendingHashtags",
+				[]driver.Value{"go", int64(12), 8.5},
+				[]driver.Value{"chirpy", int64(3), 2.25},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/hashtags/trending"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerTrendingHashtags(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				if len(f.called("GetTrendingHashtags")) != 0 {
+					t.Error("query should not run on invalid input")
+				}
+				return
+			}
+
+			args := f.called("GetTrendingHashtags")[0]
+			if args[0] != tc.wantHalfLife || args[2] != tc.wantLimit {
+				t.Errorf("GetTrendingHashtags args = %v", args)
+			}
+			var res trendingResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Window != tc.wantWindow || len(res.Tags) != 2 || res.Tags[0].Tag != "go" || res.Tags[0].Uses != 12 {
+				t.Errorf("unexpected response %+v", res)
+			}
+		})
+	}
+}
+
+func TestHandlerGetHashtagChirps(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: "hola #go", UserID: uuid.New()}
+	f.returns("GetChirpsByHashtag", chirpRow(chirp))
+	f.returns("GetChirpStats")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/hashtags/Go/chirps", nil)
+	req.SetPathValue("tag", "Go")
+	rec := httptest.NewRecorder()
+	cfg.handlerGetHashtagChirps(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := f.called("GetChirpsByHashtag")[0][0]; got != "go" {
+		t.Errorf("tag arg = %v, want go", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/hashtags/no-valido/chirps", nil)
+	req.SetPathValue("tag", "no-valido")
+	rec = httptest.NewRecorder()
+	cfg.handlerGetHashtagChirps(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
@@ -98,6 +98,26 @@ func GetBearerToken(headers http.Header) (string, error){
 	return token, nil
 }
 
+// GetAPIKey extrae la key de un header "Authorization: ApiKey <key>".
+func GetAPIKey(headers http.Header) (string, error){
+	authHeader := strings.TrimSpace(headers.Get("Authorization"))
+	if authHeader == "" {
+		return "", errors.New("Auth error")
+	}
+
+	const prefix = "ApiKey "
+	if len(authHeader) < len(prefix) || !strings.EqualFold(authHeader[:len(prefix)], prefix) {
+		return "", errors.New("invalid authorization header")
+	}
+
+	key := strings.TrimSpace(authHeader[len(prefix):])
+	if key == "" {
+		return "", errors.New("empty api key")
+	}
+
+	return key, nil
+}
+
 func MakeRefreshToken() (string, error){
 	// Se declara la variable para la key
 	key := make([]byte, 32)
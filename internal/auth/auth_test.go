@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetBearerToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", header: "Bearer abc.def", want: "abc.def"},
+		{name: "case insensitive", header: "bearer abc", want: "abc"},
+		{name: "missing", header: "", wantErr: true},
+		{name: "wrong scheme", header: "ApiKey abc", wantErr: true},
+		{name: "empty token", header: "Bearer   ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			if tc.header != "" {
+				h.Set("Authorization", tc.header)
+			}
+			got, err := GetBearerToken(h)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("got (%q, %v), want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", header: "ApiKey f271c81ff7084ee5b99a5091b42d486e", want: "f271c81ff7084ee5b99a5091b42d486e"},
+		{name: "case insensitive", header: "apikey  abc ", want: "abc"},
+		{name: "missing", header: "", wantErr: true},
+		{name: "bearer instead", header: "Bearer abc", wantErr: true},
+		{name: "empty key", header: "ApiKey ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			if tc.header != "" {
+				h.Set("Authorization", tc.header)
+			}
+			got, err := GetAPIKey(h)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("got (%q, %v), want %q", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SigningKey es una key asimetrica (Ed25519 o RSA) identificada por su kid.
+// Si Private es nil la key solo sirve para verificar (p.ej. una key retirada).
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet firma los access tokens con la key activa y valida con cualquiera de
+// las keys cargadas, asi se pueden rotar sin invalidar tokens vivos. Si hay un
+// secreto HMAC, HS256 sigue aceptado (y se usa para firmar si no hay keys).
+type KeySet struct {
+	active     *SigningKey
+	keys       map[string]*SigningKey
+	ordered    []*SigningKey
+	hmacSecret []byte
+}
+
+// NewKeySet arma un KeySet. La primera key con parte privada es la que firma.
+func NewKeySet(hmacSecret string, keys ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	if hmacSecret != "" {
+		ks.hmacSecret = []byte(hmacSecret)
+	}
+
+	for _, k := range keys {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+		ks.ordered = append(ks.ordered, k)
+		if ks.active == nil && k.Private != nil {
+			ks.active = k
+		}
+	}
+
+	if ks.active == nil && ks.hmacSecret == nil {
+		return nil, errors.New("no signing key or secret configured")
+	}
+	return ks, nil
+}
+
+// LoadKeySet lee las keys PEM de los paths dados, en orden.
+func LoadKeySet(hmacSecret string, paths []string) (*KeySet, error) {
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		k, err := ParseSigningKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, k)
+	}
+	return NewKeySet(hmacSecret, keys...)
+}
+
+// ParseSigningKey acepta una private key PKCS#8 ("PRIVATE KEY") o una public
+// key PKIX ("PUBLIC KEY"), Ed25519 o RSA. El kid es el thumbprint RFC 7638.
+func ParseSigningKey(pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	k := &SigningKey{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		k.Private = signer
+		k.Public = signer.Public()
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		k.Public = key
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.Method = jwt.SigningMethodRS256
+	default:
+		return nil, errors.New("only Ed25519 and RSA keys are supported")
+	}
+
+	k.ID = thumbprint(k.JWK())
+	return k, nil
+}
+
+// MakeJWT firma un access token con la key activa (o HS256 si no hay keys).
+// El rol va en el claim "role".
+func (ks *KeySet) MakeJWT(userID uuid.UUID, role Role, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Role: role,
+	}
+	return ks.sign(claims)
+}
+
+// MakeClientJWT firma un access token para un cliente OAuth: no lleva rol y
+// solo sirve para scopes.
+func (ks *KeySet) MakeClientJWT(userID, clientID, grantID uuid.UUID, scopes []string, expiresIn time.Duration) (string, error) {
+	return ks.sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+		ClientID: clientID.String(),
+		Scope:    strings.Join(scopes, " "),
+		GrantID:  grantID.String(),
+	})
+}
+
+func (ks *KeySet) sign(claims Claims) (string, error) {
+	if ks.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.Private)
+}
+
+// ValidateJWT valida un access token firmado con cualquier key del set.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseJWT es como ValidateJWT pero devuelve tambien el rol. Los tokens sin
+// claim "role" (anteriores a los roles) son de RoleUser.
+func (ks *KeySet) ParseJWT(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, ks.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+
+	claims.UserID, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, errors.New("invalid subject UUID")
+	}
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+	if _, err := ParseRole(string(claims.Role)); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		// Solo HS256 y solo si sigue habilitado
+		if ks.hmacSecret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return ks.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// El alg del header tiene que coincidir con el de la key
+	if token.Method != k.Method {
+		return nil, errors.New("unexpected signing method")
+	}
+	return k.Public, nil
+}
+
+// JWK es la representacion publica de una key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK devuelve la parte publica de la key.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+// PublicKey decodifica una key publica de otro emisor (p.ej. el JWKS de un
+// proveedor OpenID Connect). Acepta RSA, EC (P-256/384/521) y Ed25519.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch j.Kty {
+	case "RSA":
+		n, err := b64(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := b64(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, errX := b64(j.X)
+		y, errY := b64(j.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid EC point")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := b64(j.X)
+		if j.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+// JWKS publica todas las keys asimetricas. Los secretos HMAC nunca se publican.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.ordered))}
+	for _, k := range ks.ordered {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	return set
+}
+
+// thumbprint calcula el JWK thumbprint (RFC 7638) con los miembros requeridos
+// en orden lexicografico.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
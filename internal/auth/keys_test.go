@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newEd25519Key(t *testing.T) *SigningKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mustParseKey(t, priv)
+}
+
+func newRSAKey(t *testing.T) *SigningKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mustParseKey(t, priv)
+}
+
+func mustParseKey(t *testing.T, priv crypto.Signer) *SigningKey {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	return k
+}
+
+func publicOnly(t *testing.T, k *SigningKey) *SigningKey {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(k.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	return pub
+}
+
+func TestKeySetSignsWithActiveKey(t *testing.T) {
+	userID := uuid.New()
+
+	for _, k := range []*SigningKey{newEd25519Key(t), newRSAKey(t)} {
+		t.Run(k.Method.Alg(), func(t *testing.T) {
+			ks, err := NewKeySet("", k)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := ks.MakeJWT(userID, RoleUser, time.Minute)
+			if err != nil {
+				t.Fatalf("MakeJWT: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != k.ID || parsed.Header["alg"] != k.Method.Alg() {
+				t.Errorf("header = %v, want kid %s alg %s", parsed.Header, k.ID, k.Method.Alg())
+			}
+
+			got, err := ks.ValidateJWT(token)
+			if err != nil || got != userID {
+				t.Errorf("ValidateJWT = (%v, %v), want %v", got, err, userID)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	userID := uuid.New()
+	oldKey, newKey := newEd25519Key(t), newEd25519Key(t)
+
+	before, err := NewKeySet("", oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.MakeJWT(userID, RoleUser, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Despues de rotar, la key vieja queda solo para verificar
+	after, err := NewKeySet("", newKey, publicOnly(t, oldKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.ValidateJWT(oldToken); err != nil {
+		t.Errorf("token signed with retired key should still validate: %v", err)
+	}
+	newToken, err := after.MakeJWT(userID, RoleUser, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.ValidateJWT(newToken); err == nil {
+		t.Error("token signed with an unknown kid should not validate")
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != newKey.ID || jwks.Keys[1].Kid != oldKey.ID {
+		t.Errorf("unexpected JWKS %+v", jwks)
+	}
+}
+
+func TestKeySetHMACCompatibility(t *testing.T) {
+	userID := uuid.New()
+	legacy, err := MakeJWT(userID, "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withSecret, err := NewKeySet("secret", newEd25519Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := withSecret.ValidateJWT(legacy); err != nil || got != userID {
+		t.Errorf("HS256 token should validate while the secret is configured: %v", err)
+	}
+
+	withoutSecret, err := NewKeySet("", newEd25519Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withoutSecret.ValidateJWT(legacy); err == nil {
+		t.Error("HS256 token should be rejected once the secret is removed")
+	}
+
+	hmacOnly, err := NewKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := hmacOnly.MakeJWT(userID, RoleUser, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ValidateJWT(token, "secret"); err != nil || got != userID {
+		t.Errorf("HMAC-only key set should sign HS256 tokens: %v", err)
+	}
+	if len(hmacOnly.JWKS().Keys) != 0 {
+		t.Error("HMAC secrets must never be published")
+	}
+
+	if _, err := NewKeySet(""); err == nil {
+		t.Error("expected error with no keys and no secret")
+	}
+}
+
+func TestKeySetRejectsAlgorithmMismatch(t *testing.T) {
+	k := newEd25519Key(t)
+	ks, err := NewKeySet("", k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token firmado con RS256 pero con el kid de la key Ed25519
+	other := newRSAKey(t)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	token.Header["kid"] = k.ID
+	signed, err := token.SignedString(other.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(signed); err == nil {
+		t.Error("expected algorithm mismatch to be rejected")
+	}
+}
+
+func TestThumbprintRFC8037(t *testing.T) {
+	// RFC 8037, Appendix A.3
+	x := "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	got := thumbprint(JWK{Kty: "OKP", Crv: "Ed25519", X: x})
+	if want := "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; got != want {
+		t.Errorf("thumbprint = %s, want %s", got, want)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(x)
+	k := &SigningKey{Method: jwt.SigningMethodEdDSA, Public: ed25519.PublicKey(raw)}
+	if jwk := k.JWK(); jwk.X != x || jwk.Kty != "OKP" || !strings.EqualFold(jwk.Alg, "EdDSA") {
+		t.Errorf("unexpected JWK %+v", jwk)
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// Prefijos de los tokens opacos de OAuth, igual que RefreshTokenPrefix.
+const (
+	ClientSecretPrefix      = "chirpy_cs_"
+	AuthorizationCodePrefix = "chirpy_ac_"
+	OAuthRefreshTokenPrefix = "chirpy_ort_"
+)
+
+// PKCEChallenge es el code_challenge S256 de un code_verifier (RFC 7636 4.2).
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE chequea un code_verifier contra el code_challenge S256 guardado.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !ValidPKCEValue(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// ValidPKCEValue dice si s tiene la forma de un code_verifier (o de un
+// challenge S256): 43 a 128 caracteres "unreserved" (RFC 7636 4.1).
+func ValidPKCEValue(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
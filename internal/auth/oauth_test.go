@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Vector del apendice B de RFC 7636
+func TestPKCERFC7636(t *testing.T) {
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Errorf("PKCEChallenge = %s, want %s", got, challenge)
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("VerifyPKCE rejected the RFC vector")
+	}
+	if VerifyPKCE(verifier+"x", challenge) || VerifyPKCE(challenge, challenge) {
+		t.Error("VerifyPKCE accepted a wrong verifier")
+	}
+}
+
+func TestValidPKCEValue(t *testing.T) {
+	for s, want := range map[string]bool{
+		strings.Repeat("a", 42):       false,
+		strings.Repeat("a", 43):       true,
+		strings.Repeat("a", 128):      true,
+		strings.Repeat("a", 129):      false,
+		strings.Repeat("-._~", 11):    true,
+		strings.Repeat("a", 42) + "+": false,
+		strings.Repeat("a", 42) + " ": false,
+		strings.Repeat("a", 42) + "é": false,
+	} {
+		if got := ValidPKCEValue(s); got != want {
+			t.Errorf("ValidPKCEValue(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestMakeClientJWT(t *testing.T) {
+	userID, clientID, grantID := uuid.New(), uuid.New(), uuid.New()
+	ks := mustKeySet(t, "", newEd25519Key(t))
+
+	token, err := ks.MakeClientJWT(userID, clientID, grantID, []string{"chirps:read", "profile:write"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ks.ParseJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.Delegated() || claims.UserID != userID || claims.ClientID != clientID.String() || claims.GrantID != grantID.String() ||
+		!slices.Equal(claims.Scopes(), []string{"chirps:read", "profile:write"}) || claims.ID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// Un token de login no es delegado
+	own, _ := ks.MakeJWT(userID, RoleUser, time.Minute)
+	if claims, _ := ks.ParseJWT(own); claims.Delegated() || len(claims.Scopes()) != 0 {
+		t.Errorf("login token claims = %+v", claims)
+	}
+}
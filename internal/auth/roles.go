@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Role es el rol de un usuario. Cada rol incluye los permisos de los anteriores.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRank = map[Role]int{RoleUser: 1, RoleModerator: 2, RoleAdmin: 3}
+
+// ParseRole valida el nombre de un rol.
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return r, nil
+}
+
+// Allows dice si r alcanza para algo que pide required (admin > moderator > user).
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[required]
+}
+
+// Outranks dice si r esta estrictamente por encima de other: solo asi se
+// puede moderar a otro usuario.
+func (r Role) Outranks(other Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank > roleRank[other]
+}
+
+// Claims son los claims de un access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role Role `json:"role,omitempty"`
+
+	// Solo en tokens emitidos a un cliente OAuth (RFC 9068): el token vale
+	// para los scopes de Scope y GrantID es la autorizacion de la que salio.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	GrantID  string `json:"sid,omitempty"`
+
+	// UserID es el Subject ya parseado; no se serializa.
+	UserID uuid.UUID `json:"-"`
+}
+
+// Delegated dice si el token es de un cliente OAuth y no de un login propio.
+func (c *Claims) Delegated() bool {
+	return c.ClientID != ""
+}
+
+// Scopes devuelve los scopes de un token delegado.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{Role("root"), RoleUser, false},
+	}
+
+	for _, tc := range tests {
+		if got := tc.role.Allows(tc.required); got != tc.want {
+			t.Errorf("%s.Allows(%s) = %v, want %v", tc.role, tc.required, got, tc.want)
+		}
+	}
+}
+
+func TestRoleOutranks(t *testing.T) {
+	tests := []struct {
+		role  Role
+		other Role
+		want  bool
+	}{
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleUser, RoleUser, false},
+		{Role("root"), RoleUser, false},
+	}
+
+	for _, tc := range tests {
+		if got := tc.role.Outranks(tc.other); got != tc.want {
+			t.Errorf("%s.Outranks(%s) = %v, want %v", tc.role, tc.other, got, tc.want)
+		}
+	}
+}
+
+func TestParseJWTRole(t *testing.T) {
+	userID := uuid.New()
+
+	for _, ks := range []*KeySet{mustKeySet(t, "secret"), mustKeySet(t, "", newEd25519Key(t))} {
+		token, err := ks.MakeJWT(userID, RoleModerator, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := ks.ParseJWT(token)
+		if err != nil {
+			t.Fatalf("ParseJWT: %v", err)
+		}
+		if claims.UserID != userID || claims.Role != RoleModerator {
+			t.Errorf("claims = (%v, %v), want (%v, moderator)", claims.UserID, claims.Role, userID)
+		}
+	}
+
+	// Los tokens de antes de los roles son de usuarios comunes
+	ks := mustKeySet(t, "secret")
+	legacy, err := MakeJWT(userID, "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := ks.ParseJWT(legacy); err != nil || claims.Role != RoleUser {
+		t.Errorf("legacy token: claims %+v, err %v", claims, err)
+	}
+
+	// Un rol desconocido invalida el token
+	bad, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Role: "root",
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ParseJWT(bad); err == nil {
+		t.Error("expected unknown role to be rejected")
+	}
+}
+
+func mustKeySet(t *testing.T, secret string, keys ...*SigningKey) *KeySet {
+	t.Helper()
+	ks, err := NewKeySet(secret, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// APIKeyPrefix va adelante de cada API key, igual que RefreshTokenPrefix.
+const APIKeyPrefix = "chirpy_ak_"
+
+// Scope es un permiso de una API key. Los access tokens de login no tienen
+// scopes: pueden todo lo que puede el usuario.
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+var knownScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ParseScopes valida una lista de scopes y la devuelve ordenada y sin
+// repetidos.
+func ParseScopes(ss []string) ([]Scope, error) {
+	if len(ss) == 0 {
+		return nil, fmt.Errorf("no scopes")
+	}
+	scopes := make([]Scope, 0, len(ss))
+	for _, s := range ss {
+		if !slices.Contains(knownScopes, Scope(s)) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		scopes = append(scopes, Scope(s))
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+// HasScope dice si scopes incluye required.
+func HasScope(scopes []string, required Scope) bool {
+	return slices.Contains(scopes, string(required))
+}
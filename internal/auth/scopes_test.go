@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	got, err := ParseScopes([]string{"profile:write", "chirps:read", "profile:write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Scope{ScopeChirpsRead, ScopeProfileWrite}; !slices.Equal(got, want) {
+		t.Errorf("ParseScopes = %v, want %v", got, want)
+	}
+
+	for _, bad := range [][]string{nil, {}, {"chirps:delete"}, {"chirps:read", "admin"}, {""}} {
+		if _, err := ParseScopes(bad); err == nil {
+			t.Errorf("ParseScopes(%q) should fail", bad)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	scopes := []string{"chirps:read"}
+	if !HasScope(scopes, ScopeChirpsRead) || HasScope(scopes, ScopeChirpsWrite) || HasScope(nil, ScopeChirpsRead) {
+		t.Error("HasScope gave the wrong answer")
+	}
+}
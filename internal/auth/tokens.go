@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken devuelve el SHA-256 (hex) de un token opaco. En la DB se guarda
+// solo el hash, asi un dump no alcanza para usar los tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenPrefix va adelante de cada refresh token. Con un prefijo fijo un
+// token filtrado (en un log, en un repo) se reconoce y se puede buscar.
+const RefreshTokenPrefix = "chirpy_rt_"
+
+// MakePrefixedToken es MakeRefreshToken con prefix adelante.
+func MakePrefixedToken(prefix string) (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return prefix + token, nil
+}
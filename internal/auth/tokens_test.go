@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestHashToken(t *testing.T) {
+	// Vector de FIPS 180-2
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashToken("abc"); got != want {
+		t.Errorf("HashToken = %s, want %s", got, want)
+	}
+}
+
+func TestMakePrefixedToken(t *testing.T) {
+	a, err := MakePrefixedToken(RefreshTokenPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := MakePrefixedToken(RefreshTokenPrefix)
+
+	raw, ok := strings.CutPrefix(a, "chirpy_rt_")
+	if !ok || a == b {
+		t.Fatalf("tokens %q, %q", a, b)
+	}
+	if key, err := hex.DecodeString(raw); err != nil || len(key) != 32 {
+		t.Errorf("token body %q: %d bytes (%v)", raw, len(key), err)
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP como lo usan las apps de autenticacion (RFC 6238): SHA-1, 6 digitos y
+// pasos de 30 segundos.
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// Pasos de tolerancia para relojes corridos, para cada lado
+	totpSkew = 1
+)
+
+var ErrInvalidTOTP = errors.New("invalid TOTP code")
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret devuelve un secreto de 160 bits en base32 sin padding,
+// que es lo que esperan las apps.
+func GenerateTOTPSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(key), nil
+}
+
+// TOTPURI arma el otpauth:// que las apps leen del QR.
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTPDigits))
+	v.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// ValidateTOTP chequea code contra el secreto en now (+/- un paso) y devuelve
+// el paso que coincidio. Guardando el ultimo paso usado se evita que el mismo
+// codigo sirva dos veces.
+func ValidateTOTP(secret, code string, now time.Time) (int64, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, err
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != TOTPDigits {
+		return 0, ErrInvalidTOTP
+	}
+
+	step := totpStep(now)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		want := hotp(key, step+int64(i), TOTPDigits, sha1.New)
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step + int64(i), nil
+		}
+	}
+	return 0, ErrInvalidTOTP
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// hotp es el HOTP de RFC 4226 con el contador y el hash dados.
+func hotp(key []byte, counter int64, digits int, alg func() hash.Hash) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(alg, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, bin%mod)
+}
+
+// GenerateRecoveryCodes devuelve n codigos de recuperacion de 80 bits con la
+// forma xxxx-xxxx-xxxx-xxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(b32.EncodeToString(raw))
+		codes = append(codes, s[0:4]+"-"+s[4:8]+"-"+s[8:12]+"-"+s[12:16])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode saca guiones y espacios y pasa a minusculas, asi el
+// hash no depende de como lo tipeo el usuario.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// TOTPCode devuelve el codigo vigente en t para el secreto en base32.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(t), TOTPDigits, sha1.New), nil
+}
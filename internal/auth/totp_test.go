@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vectores del apendice B de RFC 6238 (8 digitos, pasos de 30s)
+func TestTOTPRFC6238(t *testing.T) {
+	seeds := map[string]struct {
+		key []byte
+		alg func() hash.Hash
+	}{
+		"SHA1":   {[]byte("12345678901234567890"), sha1.New},
+		"SHA256": {[]byte("12345678901234567890123456789012"), sha256.New},
+		"SHA512": {[]byte("1234567890123456789012345678901234567890123456789012345678901234"), sha512.New},
+	}
+
+	tests := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1111111111, map[string]string{"SHA1": "14050471", "SHA256": "67062674", "SHA512": "99943326"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{2000000000, map[string]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+
+	for _, tc := range tests {
+		for name, seed := range seeds {
+			step := totpStep(time.Unix(tc.unix, 0))
+			if got := hotp(seed.key, step, 8, seed.alg); got != tc.want[name] {
+				t.Errorf("T=%d %s: got %s, want %s", tc.unix, name, got, tc.want[name])
+			}
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// Base32 de la semilla SHA-1 del RFC
+	secret := b32.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+
+	// Los ultimos 6 digitos del vector de 8
+	if got, err := ValidateTOTP(secret, "050471", now); err != nil || got != step {
+		t.Errorf("ValidateTOTP = (%d, %v), want (%d, nil)", got, err, step)
+	}
+
+	if code, err := TOTPCode(secret, now); err != nil || code != "050471" {
+		t.Errorf("TOTPCode = (%q, %v)", code, err)
+	}
+
+	prev := hotp([]byte("12345678901234567890"), step-1, TOTPDigits, sha1.New)
+	if got, err := ValidateTOTP(secret, prev, now); err != nil || got != step-1 {
+		t.Errorf("previous step: (%d, %v)", got, err)
+	}
+	old := hotp([]byte("12345678901234567890"), step-2, TOTPDigits, sha1.New)
+	if _, err := ValidateTOTP(secret, old, now); err != ErrInvalidTOTP {
+		t.Errorf("two steps back should fail, got %v", err)
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "000000"} {
+		if _, err := ValidateTOTP(secret, bad, now); err == nil {
+			t.Errorf("ValidateTOTP(%q) should fail", bad)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := b32.DecodeString(secret); err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes (%v)", secret, len(key), err)
+	}
+
+	u, err := url.Parse(TOTPURI("Chirpy", "a@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Chirpy:a@example.com" ||
+		q.Get("secret") != secret || q.Get("issuer") != "Chirpy" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected URI %s", u)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 19 || strings.Count(c, "-") != 3 || seen[c] {
+			t.Errorf("bad or repeated code %q", c)
+		}
+		seen[c] = true
+	}
+	if len(codes) != 10 {
+		t.Errorf("got %d codes", len(codes))
+	}
+
+	if got := NormalizeRecoveryCode(" ABCD-efgh ijkl-MNOP"); got != "abcdefghijklmnop" {
+		t.Errorf("NormalizeRecoveryCode = %q", got)
+	}
+}
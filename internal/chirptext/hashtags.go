@@ -0,0 +1,68 @@
+// Package chirptext extrae entidades (#hashtags, @menciones) del body de un chirp.
+package chirptext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxHashtagLength es el largo maximo de un tag, en runas.
+const MaxHashtagLength = 100
+
+// ExtractHashtags devuelve los #tags del body, en minuscula, sin repetir y en
+// el orden en que aparecen. Un tag puede tener letras y numeros de cualquier
+// alfabeto y '_' pero al menos una letra, y no puede venir pegado a una palabra
+// ("foo#bar") ni a un '&' (entidades HTML como "&#39;").
+func ExtractHashtags(body string) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if !isHashSign(runes[i]) {
+			continue
+		}
+		if i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '&' || isHashSign(runes[i-1])) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isTagRune(runes[j]) {
+			j++
+		}
+		if tag, ok := NormalizeHashtag(string(runes[i+1 : j])); ok && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		i = j - 1
+	}
+	return tags
+}
+
+// NormalizeHashtag valida un tag (con o sin '#') y lo devuelve en minuscula.
+func NormalizeHashtag(tag string) (string, bool) {
+	tag = strings.TrimLeftFunc(tag, isHashSign)
+
+	count, hasLetter := 0, false
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", false
+		}
+		if unicode.IsLetter(r) || unicode.IsMark(r) {
+			hasLetter = true
+		}
+		count++
+	}
+	if count == 0 || count > MaxHashtagLength || !hasLetter {
+		return "", false
+	}
+	return strings.ToLower(tag), true
+}
+
+func isHashSign(r rune) bool {
+	return r == '#' || r == '＃'
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,58 @@
+package chirptext
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{body: "no tags here", want: nil},
+		{body: "#Go is fun #golang", want: []string{"go", "golang"}},
+		{body: "repeat #Go #go #GO", want: []string{"go"}},
+		{body: "punctuation #kerfuffle! and (#parens), #end.", want: []string{"kerfuffle", "parens", "end"}},
+		{body: "unicode #café #日本語 #Ελλάδα", want: []string{"café", "日本語", "ελλάδα"}},
+		{body: "fullwidth ＃タグ", want: []string{"タグ"}},
+		{body: "underscores #snake_case_tag", want: []string{"snake_case_tag"}},
+		{body: "numbers #2024 #web3", want: []string{"web3"}},
+		{body: "glued foo#bar and ##double", want: nil},
+		{body: "entity &#39; stays out", want: nil},
+		{body: "combining #cafe\u0301", want: []string{"cafe\u0301"}},
+		{body: "masked #**** word", want: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.body, func(t *testing.T) {
+			if got := ExtractHashtags(tc.body); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ExtractHashtags(%q) = %q, want %q", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{in: "#GoLang", want: "golang", wantOK: true},
+		{in: "GoLang", want: "golang", wantOK: true},
+		{in: "", wantOK: false},
+		{in: "#", wantOK: false},
+		{in: "123", wantOK: false},
+		{in: "with space", wantOK: false},
+		{in: strings.Repeat("a", MaxHashtagLength+1), wantOK: false},
+	}
+
+	for _, tc := range tests {
+		got, ok := NormalizeHashtag(tc.in)
+		if ok != tc.wantOK || got != tc.want {
+			t.Errorf("NormalizeHashtag(%q) = (%q, %v), want (%q, %v)", tc.in, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
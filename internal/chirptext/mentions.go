@@ -0,0 +1,80 @@
+package chirptext
+
+// MaxHandleLength es el largo maximo de un handle.
+const MaxHandleLength = 30
+
+// ExtractMentions devuelve los @handles del body, en minuscula, sin repetir y
+// en el orden en que aparecen. Un '@' pegado a una palabra (un email como
+// "ana@example.com") no cuenta, y un handle mas largo que MaxHandleLength se
+// ignora entero en vez de cortarlo.
+func ExtractMentions(body string) []string {
+	var handles []string
+	seen := map[string]bool{}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if !isAtSign(runes[i]) {
+			continue
+		}
+		if i > 0 && (isHandleRune(runes[i-1]) || isAtSign(runes[i-1])) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isHandleRune(runes[j]) {
+			j++
+		}
+		// "@José" no es una mencion a @jos
+		if j < len(runes) && isTagRune(runes[j]) {
+			i = j
+			continue
+		}
+		if handle, ok := NormalizeHandle(string(runes[i+1 : j])); ok && !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+		i = j - 1
+	}
+	return handles
+}
+
+// ValidHandle dice si handle (sin '@') se puede usar como nombre de usuario:
+// entre 1 y MaxHandleLength letras ASCII, numeros o '_'.
+func ValidHandle(handle string) bool {
+	if len(handle) == 0 || len(handle) > MaxHandleLength {
+		return false
+	}
+	for _, r := range handle {
+		if !isHandleRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeHandle valida un handle (con o sin '@') y lo devuelve en minuscula,
+// que es como se compara contra la base.
+func NormalizeHandle(handle string) (string, bool) {
+	if len(handle) > 0 && handle[0] == '@' {
+		handle = handle[1:]
+	}
+	if !ValidHandle(handle) {
+		return "", false
+	}
+	// Solo hay ASCII, asi que alcanza con bajar A-Z
+	out := []byte(handle)
+	for i, c := range out {
+		if 'A' <= c && c <= 'Z' {
+			out[i] = c + ('a' - 'A')
+		}
+	}
+	return string(out), true
+}
+
+func isAtSign(r rune) bool {
+	return r == '@' || r == '＠'
+}
+
+func isHandleRune(r rune) bool {
+	return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
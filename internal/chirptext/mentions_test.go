@@ -0,0 +1,53 @@
+package chirptext
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{body: "nobody here", want: nil},
+		{body: "hola @Ana y @bob_99", want: []string{"ana", "bob_99"}},
+		{body: "repeat @ana @ANA", want: []string{"ana"}},
+		{body: "punctuation @ana, (@bob) @carl's @dan.", want: []string{"ana", "bob", "carl", "dan"}},
+		{body: "email ana@example.com stays out", want: nil},
+		{body: "double @@ana and lone @", want: nil},
+		{body: "fullwidth ＠ana", want: []string{"ana"}},
+		{body: "too long @" + strings.Repeat("a", MaxHandleLength+1), want: nil},
+		{body: "non-ascii @José but @ana", want: []string{"ana"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.body, func(t *testing.T) {
+			if got := ExtractMentions(tc.body); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ExtractMentions(%q) = %q, want %q", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "Ana_99", want: true},
+		{in: "", want: false},
+		{in: "@ana", want: false},
+		{in: "with space", want: false},
+		{in: "josé", want: false},
+		{in: strings.Repeat("a", MaxHandleLength), want: true},
+		{in: strings.Repeat("a", MaxHandleLength+1), want: false},
+	}
+
+	for _, tc := range tests {
+		if got := ValidHandle(tc.in); got != tc.want {
+			t.Errorf("ValidHandle(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
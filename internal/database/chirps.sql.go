@@ -7,23 +7,33 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id)
+SELECT gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+WHERE NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = $2
+  AND   users.suspended_at IS NOT NULL
+)
+RETURNING id, created_at, updated_at, body, user_id, parent_id, search_vector, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+	ParentID uuid.NullUUID
 }
 
+// No inserta nada (sql.ErrNoRows) si el autor esta suspendido.
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.ParentID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,13 +41,27 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentID,
+		&i.SearchVector,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
+const deleteChirp = `-- name: DeleteChirp :exec
+
+DELETE FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+	return err
+}
+
 const getChirp = `-- name: GetChirp :one
 
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, search_vector, hidden_at
 FROM chirps 
 WHERE id = $1
 `
@@ -51,19 +75,232 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentID,
+		&i.SearchVector,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, 1 AS depth
+    FROM chirps c
+    WHERE c.id = (SELECT p.parent_id FROM chirps p WHERE p.id = $1)
+    AND   c.hidden_at IS NULL
+  UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.parent_id
+    WHERE a.depth < $2::int
+    AND   c.hidden_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, parent_id, depth
+FROM ancestors
+ORDER BY depth DESC
+`
+
+type GetChirpAncestorsParams struct {
+	ID       uuid.UUID
+	MaxDepth int32
+}
+
+type GetChirpAncestorsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	Depth     int32
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, 1 AS depth
+    FROM chirps c
+    WHERE c.parent_id = $1
+    AND   c.hidden_at IS NULL
+  UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, d.depth + 1
+    FROM chirps c
+    JOIN descendants d ON c.parent_id = d.id
+    WHERE d.depth < $2::int
+    AND   c.hidden_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, parent_id, depth
+FROM descendants
+ORDER BY depth ASC, created_at ASC, id ASC
+LIMIT $3
+`
+
+type GetChirpDescendantsParams struct {
+	ID       uuid.UUID
+	MaxDepth int32
+	MaxRows  int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	Depth     int32
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, arg.ID, arg.MaxDepth, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpStats = `-- name: GetChirpStats :many
+SELECT
+  c.id,
+  (SELECT COUNT(*) FROM chirps r WHERE r.parent_id = c.id AND r.hidden_at IS NULL) AS reply_count,
+  (SELECT COUNT(*) FROM likes l WHERE l.chirp_id = c.id) AS like_count,
+  EXISTS (
+    SELECT 1 FROM likes l
+    WHERE l.chirp_id = c.id
+    AND   l.user_id = $1::uuid
+  ) AS liked_by_me
+FROM chirps c
+WHERE c.id = ANY($2::uuid[])
+`
+
+type GetChirpStatsParams struct {
+	ViewerID uuid.NullUUID
+	Ids      []uuid.UUID
+}
+
+type GetChirpStatsRow struct {
+	ID         uuid.UUID
+	ReplyCount int64
+	LikeCount  int64
+	LikedByMe  bool
+}
+
+func (q *Queries) GetChirpStats(ctx context.Context, arg GetChirpStatsParams) ([]GetChirpStatsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpStats, arg.ViewerID, pq.Array(arg.Ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpStatsRow
+	for rows.Next() {
+		var i GetChirpStatsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.LikedByMe,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirps = `-- name: GetChirps :many
 
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, search_vector, hidden_at
 FROM chirps
-ORDER BY created_at ASC
+WHERE hidden_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND (
+    $2::timestamp IS NULL
+    OR (NOT $3::bool AND (created_at, id) > ($2::timestamp, $4::uuid))
+    OR ($3::bool AND (created_at, id) < ($2::timestamp, $4::uuid))
+  )
+ORDER BY
+  CASE WHEN $3::bool THEN created_at END DESC,
+  CASE WHEN $3::bool THEN id END DESC,
+  created_at ASC,
+  id ASC
+LIMIT $5
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpsParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	Descending     bool
+	AfterID        uuid.NullUUID
+	PageLimit      int32
+}
+
+func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.Descending,
+		arg.AfterID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +314,84 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ParentID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT
+  c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id,
+  ts_rank(c.search_vector, q.query)::real AS rank,
+  ts_headline('english', c.body, q.query, E'StartSel=\x02, StopSel=\x03, HighlightAll=true') AS headline
+FROM chirps c, websearch_to_tsquery('english', $1::text) AS q(query)
+WHERE c.search_vector @@ q.query
+  AND c.hidden_at IS NULL
+  AND (
+    $2::real IS NULL
+    OR (ts_rank(c.search_vector, q.query), c.created_at, c.id) < ($2::real, $3::timestamp, $4::uuid)
+  )
+ORDER BY rank DESC, c.created_at DESC, c.id DESC
+LIMIT $5
+`
+
+type SearchChirpsParams struct {
+	Query          string
+	AfterRank      sql.NullFloat64
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	PageLimit      int32
+}
+
+type SearchChirpsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	Rank      float32
+	Headline  string
+}
+
+// Los fragmentos resaltados se marcan con \x02 y \x03; el handler escapa el
+// HTML del body y despues los cambia por <mark></mark>.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AfterRank,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.Rank,
+			&i.Headline,
 		); err != nil {
 			return nil, err
 		}
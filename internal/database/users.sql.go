@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
@@ -14,7 +15,7 @@ import (
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
 `
 
 type CreateUserParams struct {
@@ -31,12 +32,64 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const getUserAccess = `-- name: GetUserAccess :one
+SELECT role, suspended_at IS NOT NULL AS suspended
+FROM users
+WHERE id = $1
+`
+
+type GetUserAccessRow struct {
+	Role      string
+	Suspended bool
+}
+
+// Rol y suspension vigentes: requireRole no confia en el rol del token, asi
+// un cambio de rol se aplica en el proximo request.
+func (q *Queries) GetUserAccess(ctx context.Context, id uuid.UUID) (GetUserAccessRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserAccess, id)
+	var i GetUserAccessRow
+	err := row.Scan(
+		&i.Role,
+		&i.Suspended,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
 	)
 	return i, err
 }
 
 const getUserEmail = `-- name: GetUserEmail :one
-SELECT id, created_at, updated_at, email, hashed_password
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
 FROM users
 WHERE email = $1
 `
@@ -50,28 +103,215 @@ func (q *Queries) GetUserEmail(ctx context.Context, email string) (User, error)
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const isUserSuspended = `-- name: IsUserSuspended :one
+SELECT suspended_at IS NOT NULL AS suspended
+FROM users
+WHERE id = $1
+`
+
+// Se chequea en cada request autenticado; sql.ErrNoRows si la cuenta no existe.
+func (q *Queries) IsUserSuspended(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserSuspended, id)
+	var suspended bool
+	err := row.Scan(&suspended)
+	return suspended, err
+}
+
+const promoteAdmin = `-- name: PromoteAdmin :one
+UPDATE users
+SET role = 'admin',
+    updated_at = NOW()
+WHERE email = $1
+AND   verified_at IS NOT NULL
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
+`
+
+// Para el primer admin (-promote-admin). Solo cuentas con el email verificado.
+func (q *Queries) PromoteAdmin(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, promoteAdmin, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const setUserHandle = `-- name: SetUserHandle :one
+UPDATE users
+SET handle = NULLIF($2, ''),
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
+`
+
+type SetUserHandleParams struct {
+	ID     uuid.UUID
+	Handle string
+}
+
+// Un string vacio borra el handle.
+func (q *Queries) SetUserHandle(ctx context.Context, arg SetUserHandleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserHandle, arg.ID, arg.Handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
 	)
 	return i, err
 }
 
+const setUserPassword = `-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, suspendUser, id)
+	return err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :exec
+UPDATE users
+SET suspended_at = NULL,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, unsuspendUser, id)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 
 UPDATE users
-SET email = $2,
-    hashed_password = $3,
+SET email = $1,
+    hashed_password = $2,
+    handle = NULLIF(COALESCE($3, handle), ''),
+    verified_at = CASE WHEN email = $1 THEN verified_at END,
     updated_at = now()
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
 `
 
 type UpdateUserParams struct {
-	ID             uuid.UUID
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
+	ID             uuid.UUID
 }
 
+// Si handle es NULL se deja el actual; un string vacio lo borra.
+// Cambiar el email obliga a verificarlo de nuevo.
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :one
+UPDATE users
+SET is_chirpy_red = TRUE,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at
+`
+
+func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, upgradeUserToChirpyRed, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -79,6 +319,11 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.VerifiedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	got, err := format("Chirpy <no-reply@chirpy.test>", Message{To: "a@example.com", Subject: "Hola", Body: "linea 1\nlinea 2"}, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "From: Chirpy <no-reply@chirpy.test>\r\n" +
+		"To: a@example.com\r\n" +
+		"Subject: Hola\r\n" +
+		"Date: Wed, 01 May 2024 12:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"linea 1\r\nlinea 2"
+	if string(got) != want {
+		t.Errorf("format =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	bad := []Message{
+		{To: "a@example.com\r\nBcc: b@example.com", Subject: "x"},
+		{To: "a@example.com", Subject: "x\nBcc: b@example.com"},
+		{To: "not an address", Subject: "x"},
+	}
+	for _, msg := range bad {
+		if _, err := format("no-reply@chirpy.test", msg, time.Now()); err == nil {
+			t.Errorf("format(%q) should fail", msg)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWriter("no-reply@chirpy.test", &buf)
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Verify", Body: "token: abc"}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "To: a@example.com\r\n") || !strings.HasSuffix(out, "token: abc\n.\n") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Send(ctx, Message{To: "a@example.com"}); err == nil {
+		t.Error("Send should fail with a canceled context")
+	}
+}
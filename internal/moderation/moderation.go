@@ -0,0 +1,260 @@
+// Package moderation revisa el body de los chirps contra listas de palabras.
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Action es lo que se hace cuando una regla matchea.
+type Action string
+
+const (
+	// ActionMask reemplaza la palabra por "****".
+	ActionMask Action = "mask"
+	// ActionFlag deja pasar el chirp pero lo marca para revision.
+	ActionFlag Action = "flag"
+	// ActionReject no deja publicar el chirp.
+	ActionReject Action = "reject"
+)
+
+// Mask es el texto que reemplaza a las palabras enmascaradas.
+const Mask = "****"
+
+// severity ordena las acciones: si un chirp matchea varias gana la mas grave.
+var severity = map[Action]int{ActionMask: 1, ActionFlag: 2, ActionReject: 3}
+
+// ParseAction valida el nombre de una accion.
+func ParseAction(s string) (Action, error) {
+	a := Action(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := severity[a]; !ok {
+		return "", fmt.Errorf("unknown action %q", s)
+	}
+	return a, nil
+}
+
+// Rule es una palabra prohibida y la accion que dispara.
+type Rule struct {
+	Word   string `json:"word"`
+	Action Action `json:"action"`
+}
+
+// Match es una palabra del body que disparo una regla.
+type Match struct {
+	Word   string
+	Action Action
+}
+
+// Result es el veredicto sobre un body. Body viene con las palabras de las
+// reglas mask ya enmascaradas; Action es la accion mas grave que matcheo
+// (vacia si no hubo ninguna).
+type Result struct {
+	Body    string
+	Action  Action
+	Matches []Match
+}
+
+// Rejected dice si el chirp no se puede publicar.
+func (r Result) Rejected() bool { return r.Action == ActionReject }
+
+// Flagged dice si el chirp tiene que pasar por revision.
+func (r Result) Flagged() bool { return r.Action == ActionFlag }
+
+// Filter es cualquier cosa que pueda revisar un body.
+type Filter interface {
+	Check(body string) Result
+}
+
+// Chain corre los filtros en orden: cada uno recibe el body que dejo el
+// anterior y el resultado junta todos los matches.
+func Chain(filters ...Filter) Filter {
+	return chain(filters)
+}
+
+type chain []Filter
+
+func (c chain) Check(body string) Result {
+	res := Result{Body: body}
+	for _, f := range c {
+		r := f.Check(res.Body)
+		res.Body = r.Body
+		res.Matches = append(res.Matches, r.Matches...)
+		if severity[r.Action] > severity[res.Action] {
+			res.Action = r.Action
+		}
+	}
+	return res
+}
+
+// Wordlist es un Filter por palabras completas. Las reglas se pueden cambiar
+// en caliente con SetRules, es seguro usarlo desde varias goroutines.
+type Wordlist struct {
+	mu    sync.RWMutex
+	rules map[string]Action
+}
+
+// NewWordlist arma una Wordlist con las reglas dadas (ver SetRules).
+func NewWordlist(rules []Rule) (*Wordlist, error) {
+	w := &Wordlist{}
+	if err := w.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetRules reemplaza todas las reglas. Si una palabra aparece mas de una vez
+// gana la ultima, asi una lista posterior puede pisar a otra anterior.
+func (w *Wordlist) SetRules(rules []Rule) error {
+	m := make(map[string]Action, len(rules))
+	for _, r := range rules {
+		word, err := NormalizeWord(r.Word)
+		if err != nil {
+			return err
+		}
+		if _, ok := severity[r.Action]; !ok {
+			return fmt.Errorf("unknown action %q for %q", r.Action, r.Word)
+		}
+		m[word] = r.Action
+	}
+
+	w.mu.Lock()
+	w.rules = m
+	w.mu.Unlock()
+	return nil
+}
+
+// Rules devuelve las reglas vigentes ordenadas por palabra.
+func (w *Wordlist) Rules() []Rule {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	out := make([]Rule, 0, len(w.rules))
+	for word, action := range w.rules {
+		out = append(out, Rule{Word: word, Action: action})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Word < out[j].Word })
+	return out
+}
+
+// Check parte el body en palabras (cualquier cosa que no sea letra, numero o
+// simbolo leet corta una palabra, asi "kerfuffle!" matchea) y compara cada una
+// ya normalizada contra las reglas.
+func (w *Wordlist) Check(body string) Result {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	res := Result{}
+	var out strings.Builder
+	runes := []rune(body)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		prefix, word, suffix, action, ok := w.match(runes[i:j])
+		i = j
+		if !ok {
+			out.WriteString(word)
+			continue
+		}
+		res.Matches = append(res.Matches, Match{Word: word, Action: action})
+		if severity[action] > severity[res.Action] {
+			res.Action = action
+		}
+		out.WriteString(prefix)
+		if action == ActionMask {
+			out.WriteString(Mask)
+		} else {
+			out.WriteString(word)
+		}
+		out.WriteString(suffix)
+	}
+	res.Body = out.String()
+	return res
+}
+
+// match busca la palabra en las reglas. Si no esta, prueba sin los simbolos
+// leet de los bordes: "@fornax" o "fornax$" son fornax con un simbolo pegado,
+// no otra palabra. Sin match devuelve la palabra entera en word.
+func (w *Wordlist) match(runes []rune) (prefix, word, suffix string, action Action, ok bool) {
+	word = string(runes)
+	if action, ok = w.rules[normalize(word)]; ok {
+		return "", word, "", action, true
+	}
+
+	start, end := 0, len(runes)
+	for start < end && isLeetSymbol(runes[start]) {
+		start++
+	}
+	for end > start && isLeetSymbol(runes[end-1]) {
+		end--
+	}
+	if start == end || (start == 0 && end == len(runes)) {
+		return "", word, "", "", false
+	}
+	core := string(runes[start:end])
+	if action, ok = w.rules[normalize(core)]; !ok {
+		return "", word, "", "", false
+	}
+	return string(runes[:start]), core, string(runes[end:]), action, true
+}
+
+// NormalizeWord valida que s sea una sola palabra y la devuelve normalizada,
+// que es como se guarda en las reglas.
+func NormalizeWord(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("empty word")
+	}
+	for _, r := range s {
+		if !isWordRune(r) {
+			return "", fmt.Errorf("%q is not a single word", s)
+		}
+	}
+	return normalize(s), nil
+}
+
+// leet son los reemplazos tipicos para esquivar filtros ("k3rfuffl3", "f0rn@x").
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'@': 'a',
+	'$': 's',
+}
+
+func normalize(word string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(word) {
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isLeetSymbol son los reemplazos leet que no son letra ni numero ('@', '$').
+func isLeetSymbol(r rune) bool {
+	_, ok := leet[r]
+	return ok && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+func isWordRune(r rune) bool {
+	if _, ok := leet[r]; ok {
+		return true
+	}
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+}
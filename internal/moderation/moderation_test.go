@@ -0,0 +1,118 @@
+package moderation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWordlistCheck(t *testing.T) {
+	w, err := NewWordlist([]Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "Sharbert", Action: ActionMask},
+		{Word: "fornax", Action: ActionFlag},
+		{Word: "zorblax", Action: ActionReject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		body       string
+		wantBody   string
+		wantAction Action
+		wantWords  []string
+	}{
+		{body: "nothing to see", wantBody: "nothing to see"},
+		{body: "This is a kerfuffle opinion", wantBody: "This is a **** opinion", wantAction: ActionMask, wantWords: []string{"kerfuffle"}},
+		{body: "What a kerfuffle! Sharbert's fault", wantBody: "What a ****! ****'s fault", wantAction: ActionMask, wantWords: []string{"kerfuffle", "Sharbert"}},
+		{body: "KERFUFFLE, k3rfuffl3 and $harb3rt", wantBody: "****, **** and ****", wantAction: ActionMask, wantWords: []string{"KERFUFFLE", "k3rfuffl3", "$harb3rt"}},
+		{body: "kerfuffles is another word", wantBody: "kerfuffles is another word"},
+		{body: "a f0rn@x and a kerfuffle", wantBody: "a f0rn@x and a ****", wantAction: ActionFlag, wantWords: []string{"f0rn@x", "kerfuffle"}},
+		{body: "hi @fornax and fornax$", wantBody: "hi @fornax and fornax$", wantAction: ActionFlag, wantWords: []string{"fornax", "fornax"}},
+		{body: "@kerfuffle$$ @$", wantBody: "@****$$ @$", wantAction: ActionMask, wantWords: []string{"kerfuffle"}},
+		{body: "$harbert and sharbert$", wantBody: "**** and ****$", wantAction: ActionMask, wantWords: []string{"$harbert", "sharbert"}},
+		{body: "zorblax fornax", wantBody: "zorblax fornax", wantAction: ActionReject, wantWords: []string{"zorblax", "fornax"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.body, func(t *testing.T) {
+			res := w.Check(tc.body)
+			if res.Body != tc.wantBody || res.Action != tc.wantAction {
+				t.Errorf("Check = (%q, %q), want (%q, %q)", res.Body, res.Action, tc.wantBody, tc.wantAction)
+			}
+			var words []string
+			for _, m := range res.Matches {
+				words = append(words, m.Word)
+			}
+			if !reflect.DeepEqual(words, tc.wantWords) {
+				t.Errorf("matches = %q, want %q", words, tc.wantWords)
+			}
+		})
+	}
+}
+
+func TestWordlistSetRules(t *testing.T) {
+	w, err := NewWordlist([]Rule{{Word: "kerfuffle", Action: ActionMask}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// La ultima regla para una palabra gana
+	if err := w.SetRules([]Rule{{Word: "kerfuffle", Action: ActionMask}, {Word: "K3RFUFFLE", Action: ActionReject}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Rules(); !reflect.DeepEqual(got, []Rule{{Word: "kerfuffle", Action: ActionReject}}) {
+		t.Errorf("Rules = %v", got)
+	}
+	if !w.Check("kerfuffle").Rejected() {
+		t.Error("expected reject after SetRules")
+	}
+
+	// Una regla invalida no toca las vigentes
+	if err := w.SetRules([]Rule{{Word: "two words", Action: ActionMask}}); err == nil {
+		t.Error("expected error for multi-word rule")
+	}
+	if err := w.SetRules([]Rule{{Word: "ok", Action: "delete"}}); err == nil {
+		t.Error("expected error for unknown action")
+	}
+	if len(w.Rules()) != 1 {
+		t.Errorf("rules changed after failed SetRules: %v", w.Rules())
+	}
+}
+
+func TestChain(t *testing.T) {
+	masks, _ := NewWordlist([]Rule{{Word: "kerfuffle", Action: ActionMask}})
+	flags, _ := NewWordlist([]Rule{{Word: "fornax", Action: ActionFlag}})
+
+	res := Chain(masks, flags).Check("kerfuffle fornax")
+	if res.Body != "**** fornax" || !res.Flagged() || len(res.Matches) != 2 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# palabras de siempre
+kerfuffle
+sharbert   flag
+fornax REJECT
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "sharbert", Action: ActionFlag},
+		{Word: "fornax", Action: ActionReject},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("ParseRules = %v, want %v", rules, want)
+	}
+
+	for _, bad := range []string{"word nuke", "too many fields", "bad-word"} {
+		if _, err := ParseRules(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseRules(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package oidc es el lado cliente (relying party) de OpenID Connect: discovery
+// del proveedor, el flujo authorization code con PKCE y la validacion del ID
+// token contra el JWKS del proveedor.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+)
+
+// Un kid desconocido vuelve a bajar el JWKS (el proveedor roto sus keys), pero
+// no mas seguido que esto.
+const minJWKSRefresh = time.Minute
+
+// Config es un proveedor tal como se configura.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Sin Scopes se piden openid, email y profile
+	Scopes []string
+}
+
+// Metadata es la parte del documento de discovery que se usa.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider es un proveedor OpenID Connect. El discovery se hace en el primer
+// uso y queda cacheado, asi un proveedor caido no impide arrancar.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu     sync.Mutex
+	meta   *Metadata
+	keys   map[string]crypto.PublicKey
+	keysAt time.Time
+}
+
+// NewProvider arma un Provider. Con client nil usa uno con timeout de 10s.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Issuer es el issuer configurado; junto con el subject identifica la cuenta.
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// Metadata hace el discovery (OpenID Connect Discovery 1.0, 4). El pedido se
+// hace sin el lock: un proveedor lento no frena a los que ya tienen cache.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	cached := p.meta
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var meta Metadata
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// El issuer del documento tiene que ser exactamente el configurado (4.3)
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing endpoints")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Si otro discovery termino antes, se queda el suyo
+	if p.meta == nil {
+		p.meta = &meta
+	}
+	return p.meta, nil
+}
+
+// AuthCodeURL es la URL del proveedor a la que se manda al usuario.
+// codeChallenge es el S256 del code verifier que se usa en Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization_endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange canjea el codigo del callback y devuelve el ID token sin validar.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic: id y secret van form-encoded (RFC 6749 2.3.1)
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token request: %w", err)
+	}
+	defer res.Body.Close()
+
+	var tok tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("oidc token response: status %d: %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc token response: status %d: %s %s", res.StatusCode, tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return "", errors.New("oidc token response: no id_token")
+	}
+	return tok.IDToken, nil
+}
+
+// publicKey busca la key del kid en el JWKS, bajandolo de nuevo si no esta.
+func (p *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	k, ok := p.lookupKey(kid)
+	fresh := time.Since(p.keysAt) < minJWKSRefresh
+	p.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	if fresh {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	// Como en Metadata, el JWKS se baja sin el lock: un proveedor lento no
+	// frena a los que ya tienen la key en cache
+	var set auth.JWKS
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Una key que no entendemos no invalida las demas
+		if k, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = k
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.keysAt = keys, time.Now()
+	if k, ok := p.lookupKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey acepta un token sin kid solo si el proveedor publica una sola key.
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
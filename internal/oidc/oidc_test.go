@@ -0,0 +1,232 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testUser = oidctest.User{Subject: "248289761001", Email: "jane@example.com", EmailVerified: true}
+
+func newTestProvider(idp *oidctest.IdP) *Provider {
+	return NewProvider(Config{
+		Issuer:       idp.Issuer,
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  "https://chirpy.test/callback",
+	}, nil)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.New(t)
+	idp.SetUser(testUser)
+	p := newTestProvider(idp)
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 43)
+	authURL, err := p.AuthCodeURL(ctx, "st4te", "n0nce", auth.PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// El IdP aprueba y redirige al callback con el codigo
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || callback.Query().Get("state") != "st4te" {
+		t.Fatalf("callback = %q (%v)", res.Header.Get("Location"), err)
+	}
+
+	if _, err := p.Exchange(ctx, callback.Query().Get("code"), strings.Repeat("x", 43)); err == nil {
+		t.Error("Exchange with a wrong code_verifier succeeded")
+	}
+	// El codigo de arriba ya se uso: otro login
+	res, _ = client.Get(authURL)
+	res.Body.Close()
+	callback, _ = url.Parse(res.Header.Get("Location"))
+	raw, err := p.Exchange(ctx, callback.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	tok, err := p.VerifyIDToken(ctx, raw, "n0nce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if tok.Issuer != idp.Issuer || tok.Subject != testUser.Subject || tok.Email != testUser.Email || !tok.EmailVerified {
+		t.Errorf("id token = %+v", tok)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(jwt.MapClaims)
+		hmac    bool
+		wantErr bool
+	}{
+		{name: "valid", tamper: func(jwt.MapClaims) {}},
+		{name: "email_verified as string", tamper: func(c jwt.MapClaims) { c["email_verified"] = "true" }},
+		{name: "multiple audiences with azp", tamper: func(c jwt.MapClaims) {
+			c["aud"] = []string{oidctest.ClientID, "other"}
+			c["azp"] = oidctest.ClientID
+		}},
+		{name: "wrong nonce", tamper: func(c jwt.MapClaims) { c["nonce"] = "other" }, wantErr: true},
+		{name: "no nonce", tamper: func(c jwt.MapClaims) { delete(c, "nonce") }, wantErr: true},
+		{name: "wrong audience", tamper: func(c jwt.MapClaims) { c["aud"] = "other-client" }, wantErr: true},
+		{name: "wrong issuer", tamper: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "expired", tamper: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+		{name: "no exp", tamper: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: true},
+		{name: "no sub", tamper: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: true},
+		{name: "multiple audiences without azp", tamper: func(c jwt.MapClaims) { c["aud"] = []string{oidctest.ClientID, "other"} }, wantErr: true},
+		// Firmado con el client_secret: no se aceptan algoritmos simetricos
+		{name: "HS256 with the client secret", tamper: func(jwt.MapClaims) {}, hmac: true, wantErr: true},
+	}
+
+	idp := oidctest.New(t)
+	p := newTestProvider(idp)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := idp.Claims(testUser, "n0nce")
+			tc.tamper(claims)
+			raw := idp.Sign(t, claims)
+			if tc.hmac {
+				var err error
+				raw, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(oidctest.ClientSecret))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tok, err := p.VerifyIDToken(context.Background(), raw, "n0nce")
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("VerifyIDToken accepted the token: %+v", tok)
+				}
+				return
+			}
+			if err != nil || tok.Subject != testUser.Subject || !tok.EmailVerified {
+				t.Errorf("VerifyIDToken = %+v, %v", tok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	idp := oidctest.New(t)
+	p := newTestProvider(idp)
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, idp.Sign(t, idp.Claims(testUser, "n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recien bajado el JWKS, un kid nuevo no lo vuelve a pedir
+	idp.RotateKey(t)
+	raw := idp.Sign(t, idp.Claims(testUser, "n"))
+	if _, err := p.VerifyIDToken(ctx, raw, "n"); err == nil {
+		t.Fatal("unknown kid accepted before the JWKS refresh")
+	}
+
+	p.keysAt = time.Now().Add(-minJWKSRefresh)
+	if _, err := p.VerifyIDToken(ctx, raw, "n"); err != nil {
+		t.Errorf("rotated key after refresh: %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.New(t)
+	p := NewProvider(Config{Issuer: idp.Issuer + "/", ClientID: oidctest.ClientID}, nil)
+
+	if _, err := p.Metadata(context.Background()); err == nil {
+		t.Error("discovery accepted a different issuer")
+	}
+}
+
+// Un discovery colgado no tiene que trabar a los demas pedidos: cada uno
+// respeta su propio contexto.
+func TestDiscoveryDoesNotHoldLock(t *testing.T) {
+	arrived, release := make(chan struct{}, 2), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	p := NewProvider(Config{Issuer: srv.URL, ClientID: oidctest.ClientID}, nil)
+
+	go p.Metadata(context.Background())
+	<-arrived
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := p.Metadata(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("discovery succeeded against a hung provider")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Metadata waited for another discovery in flight")
+	}
+}
+
+func TestJWKSRefreshDoesNotHoldLock(t *testing.T) {
+	arrived, release := make(chan struct{}, 1), make(chan struct{})
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/openid-configuration" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"issuer":"` + srv.URL + `","authorization_endpoint":"` + srv.URL + `/authorize","token_endpoint":"` + srv.URL + `/token","jwks_uri":"` + srv.URL + `/jwks"}`))
+			return
+		}
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	p := NewProvider(Config{Issuer: srv.URL, ClientID: oidctest.ClientID}, nil)
+
+	// Una key en cache y un JWKS viejo: un kid desconocido dispara el refresh
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.keys = map[string]crypto.PublicKey{"cached": pub}
+	p.keysAt = time.Now().Add(-2 * minJWKSRefresh)
+
+	go p.publicKey(context.Background(), "rotated")
+	<-arrived
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.publicKey(context.Background(), "cached")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("cached key: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("publicKey waited for a JWKS refresh in flight")
+	}
+}
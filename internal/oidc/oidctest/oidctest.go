@@ -0,0 +1,233 @@
+// Package oidctest es un proveedor OpenID Connect minimo sobre httptest para
+// los tests: discovery, JWKS, un /authorize que aprueba solo y /token con
+// PKCE.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ClientID     = "chirpy-test"
+	ClientSecret = "test-client-secret"
+)
+
+// User es la cuenta con la que /authorize aprueba los logins.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type pendingCode struct {
+	user        User
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// IdP es el proveedor. Issuer es la URL del server.
+type IdP struct {
+	Server *httptest.Server
+	Issuer string
+
+	mu    sync.Mutex
+	user  User
+	key   *ecdsa.PrivateKey
+	kid   string
+	codes map[string]pendingCode
+	// tamper cambia las claims del proximo ID token que emite /token
+	tamper func(jwt.MapClaims)
+}
+
+// New levanta el IdP; se cierra al terminar el test.
+func New(t *testing.T) *IdP {
+	t.Helper()
+	idp := &IdP{codes: map[string]pendingCode{}}
+	idp.RotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.handleDiscovery)
+	mux.HandleFunc("GET /jwks", idp.handleJWKS)
+	mux.HandleFunc("GET /authorize", idp.handleAuthorize)
+	mux.HandleFunc("POST /token", idp.handleToken)
+	idp.Server = httptest.NewServer(mux)
+	idp.Issuer = idp.Server.URL
+	t.Cleanup(idp.Server.Close)
+	return idp
+}
+
+// SetUser cambia la cuenta con la que se loguea el proximo /authorize.
+func (idp *IdP) SetUser(u User) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.user = u
+}
+
+// Tamper modifica las claims del proximo ID token (para probar rechazos).
+func (idp *IdP) Tamper(fn func(jwt.MapClaims)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.tamper = fn
+}
+
+// RotateKey cambia la key con la que se firma (y la unica del JWKS).
+func (idp *IdP) RotateKey(t *testing.T) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key = key
+	idp.kid = rand.Text()[:8]
+}
+
+// Sign firma claims con la key actual, como un ID token.
+func (idp *IdP) Sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	raw, err := idp.sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// Claims son las claims de un ID token valido para ClientID.
+func (idp *IdP) Claims(u User, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.Issuer,
+		"sub":            u.Subject,
+		"aud":            ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          u.Email,
+		"email_verified": u.EmailVerified,
+	}
+}
+
+func (idp *IdP) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = idp.kid
+	return token.SignedString(idp.key)
+}
+
+func (idp *IdP) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 idp.Issuer,
+		"authorization_endpoint": idp.Issuer + "/authorize",
+		"token_endpoint":         idp.Issuer + "/token",
+		"jwks_uri":               idp.Issuer + "/jwks",
+	})
+}
+
+func (idp *IdP) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	pub := idp.key.PublicKey
+	kid := idp.kid
+	idp.mu.Unlock()
+
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	writeJSON(w, http.StatusOK, auth.JWKS{Keys: []auth.JWK{{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+	}}})
+}
+
+// handleAuthorize aprueba sin preguntar y vuelve al redirect_uri con el codigo.
+func (idp *IdP) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirect.IsAbs() {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	idp.mu.Lock()
+	idp.codes[code] = pendingCode{
+		user:        idp.user,
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+	}
+	idp.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *IdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != ClientID || secret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := idp.Claims(code.user, code.nonce)
+	if idp.tamper != nil {
+		idp.tamper(claims)
+		idp.tamper = nil
+	}
+	raw, err := idp.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"id_token":     raw,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
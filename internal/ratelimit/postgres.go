@@ -0,0 +1,34 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+)
+
+// Postgres guarda los buckets en rate_limit_buckets, asi el limite es el
+// mismo para todas las instancias. Usa el reloj de la DB.
+type Postgres struct {
+	db *database.Queries
+}
+
+func NewPostgres(db *database.Queries) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	row, err := p.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(l.Burst),
+		Rate:  l.Rate,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result(l, row.Tokens, row.Allowed), nil
+}
+
+func (p *Postgres) Sweep(ctx context.Context, idle time.Duration) error {
+	return p.db.DeleteIdleRateLimitBuckets(ctx, idle.Seconds())
+}
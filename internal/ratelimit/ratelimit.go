@@ -0,0 +1,101 @@
+// Package ratelimit implementa un token bucket con dos backends: Memory, para
+// una sola instancia, y Postgres, compartido entre instancias.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit es un bucket de Burst tokens que se rellena a Rate tokens por segundo.
+type Limit struct {
+	Burst int
+	Rate  float64
+}
+
+// PerPeriod es el limite "n requests cada period": arranca con n tokens y los
+// repone todos en period.
+func PerPeriod(n int, period time.Duration) Limit {
+	return Limit{Burst: n, Rate: float64(n) / period.Seconds()}
+}
+
+// ParseLimit lee "n/period", por ejemplo "10/1m" o "300/1h".
+func ParseLimit(s string) (Limit, error) {
+	n, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q: want n/period", s)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: invalid count", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: invalid period", s)
+	}
+	return PerPeriod(burst, d), nil
+}
+
+// ParseRouteLimits lee "patron=n/period;patron=n/period", con los patrones
+// tal cual se registran en el mux ("POST /api/chirps").
+func ParseRouteLimits(s string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		pattern, limit, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("route limit %q: want pattern=n/period", entry)
+		}
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(pattern)] = l
+	}
+	return limits, nil
+}
+
+// Result es lo que queda del bucket despues de un Take.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset es cuanto falta para que el bucket este lleno de nuevo
+	Reset time.Duration
+	// RetryAfter es cuanto falta para el proximo token (solo si !Allowed)
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	// Take intenta sacar un token del bucket de key.
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+	// Sweep borra los buckets que no se usan hace mas de idle.
+	Sweep(ctx context.Context, idle time.Duration) error
+}
+
+// result arma el Result a partir de los tokens que quedaron.
+func result(l Limit, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     seconds((float64(l.Burst) - tokens) / l.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
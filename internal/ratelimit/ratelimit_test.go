@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit(" 10/1m ")
+	if err != nil || l.Burst != 10 || l.Rate != 10.0/60 {
+		t.Errorf("ParseLimit = %+v, %v", l, err)
+	}
+	for _, bad := range []string{"", "10", "x/1m", "0/1m", "10/x", "10/0s", "-1/1m"} {
+		if _, err := ParseLimit(bad); err == nil {
+			t.Errorf("ParseLimit(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseRouteLimits(t *testing.T) {
+	limits, err := ParseRouteLimits("POST /api/chirps=10/1m; GET /api/chirps/{chirpID} = 120/1m;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 || limits["POST /api/chirps"].Burst != 10 || limits["GET /api/chirps/{chirpID}"].Burst != 120 {
+		t.Errorf("ParseRouteLimits = %v", limits)
+	}
+	if limits, err := ParseRouteLimits(""); err != nil || len(limits) != 0 {
+		t.Errorf("empty: %v, %v", limits, err)
+	}
+	for _, bad := range []string{"POST /api/chirps", "=10/1m", "POST /api/chirps=10"} {
+		if _, err := ParseRouteLimits(bad); err == nil {
+			t.Errorf("ParseRouteLimits(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMemoryTake(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	l := PerPeriod(3, 30*time.Second) // un token cada 10s
+
+	for i := 2; i >= 0; i-- {
+		res, _ := m.Take(ctx, "k", l)
+		if !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("take %d: %+v", 3-i, res)
+		}
+	}
+	res, _ := m.Take(ctx, "k", l)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 10*time.Second || res.Reset != 30*time.Second {
+		t.Fatalf("empty bucket: %+v", res)
+	}
+
+	// Otra clave tiene su propio bucket
+	if res, _ := m.Take(ctx, "other", l); !res.Allowed {
+		t.Error("other key should not be limited")
+	}
+
+	// A los 10s vuelve un token
+	now = now.Add(10 * time.Second)
+	if res, _ := m.Take(ctx, "k", l); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after refill: %+v", res)
+	}
+	// Nunca pasa de Burst
+	now = now.Add(time.Hour)
+	if res, _ := m.Take(ctx, "k", l); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("after an hour: %+v", res)
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	l := PerPeriod(1, time.Minute)
+
+	m.Take(ctx, "old", l)
+	now = now.Add(2 * time.Minute)
+	m.Take(ctx, "new", l)
+
+	if err := m.Sweep(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.buckets["old"]; ok {
+		t.Error("idle bucket not swept")
+	}
+	if _, ok := m.buckets["new"]; !ok {
+		t.Error("recent bucket swept")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestLikedByMeNeedsValidBearer(t *testing.T) {
+	viewer := uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: "c", UserID: uuid.New()}
+	liked := true
+
+	tests := []struct {
+		name          string
+		auth          string
+		wantLikedByMe *bool
+		wantViewerArg driver.Value
+	}{
+		{name: "anonymous", wantViewerArg: nil},
+		{name: "invalid token", auth: "Bearer nope", wantViewerArg: nil},
+		{name: "authenticated", auth: bearer(t, viewer), wantLikedByMe: &liked, wantViewerArg: viewer.String()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("GetChirp", chirpRow(chirp))
+			f.returns("GetChirpStats", []driver.Value{chirp.ID.String(), int64(0), int64(3), true})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String(), nil)
+			req.SetPathValue("chirpID", chirp.ID.String())
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerGetChirpById(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+			}
+			var res chirpResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res.LikeCount != 3 {
+				t.Errorf("like_count = %d, want 3", res.LikeCount)
+			}
+			if (res.LikedByMe == nil) != (tc.wantLikedByMe == nil) || (res.LikedByMe != nil && *res.LikedByMe != *tc.wantLikedByMe) {
+				t.Errorf("liked_by_me = %v, want %v", res.LikedByMe, tc.wantLikedByMe)
+			}
+			if got := f.called("GetChirpStats")[0][0]; got != tc.wantViewerArg {
+				t.Errorf("viewer arg = %v, want %v", got, tc.wantViewerArg)
+			}
+		})
+	}
+}
+
+func TestHandlerLikeChirp(t *testing.T) {
+	user := uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), Body: "c", UserID: uuid.New()}
+
+	cfg, f := newTestConfig(t)
+	f.returns("GetChirp", chirpRow(chirp))
+	f.returns("LikeChirp")
+
+	// Dos PUT seguidos: los dos 204
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirp.ID.String()+"/like", nil)
+		req.SetPathValue("chirpID", chirp.ID.String())
+		req.Header.Set("Authorization", bearer(t, user))
+		rec := httptest.NewRecorder()
+		cfg.handlerLikeChirp(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", rec.Code)
+		}
+	}
+
+	likes := f.called("LikeChirp")
+	if len(likes) != 2 || likes[0][0] != user.String() || likes[0][1] != chirp.ID.String() {
+		t.Errorf("LikeChirp calls = %v", likes)
+	}
+
+	// Chirp inexistente
+	f.returns("GetChirp")
+	req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirp.ID.String()+"/like", nil)
+	req.SetPathValue("chirpID", chirp.ID.String())
+	req.Header.Set("Authorization", bearer(t, user))
+	rec := httptest.NewRecorder()
+	cfg.handlerLikeChirp(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+)
+
+// Pasada la ventana sin fallos el contador vuelve a cero
+const loginFailureWindow = 24 * time.Hour
+
+// lockoutPolicy: los primeros Threshold fallos son gratis; despues cada fallo
+// bloquea Base, 2*Base, 4*Base... hasta Max.
+type lockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+var (
+	defaultEmailLockout = lockoutPolicy{Threshold: 5, Base: 30 * time.Second, Max: 15 * time.Minute}
+	// Por IP se deja mas margen porque muchos usuarios pueden compartirla
+	defaultIPLockout = lockoutPolicy{Threshold: 20, Base: 30 * time.Second, Max: 15 * time.Minute}
+)
+
+func (p lockoutPolicy) delay(failures int) time.Duration {
+	if p.Base <= 0 || failures <= p.Threshold {
+		return 0
+	}
+	exp := failures - p.Threshold - 1
+	// Pasado este exponente ya estamos en Max de todas formas
+	if exp > 30 {
+		return p.Max
+	}
+	d := p.Base * time.Duration(1<<exp)
+	if d > p.Max {
+		return p.Max
+	}
+	return d
+}
+
+// clientIP devuelve la IP del cliente. Con TRUST_PROXY se usa la ultima
+// entrada de X-Forwarded-For, la que agrega nuestro proxy; las anteriores
+// las puede inventar el cliente.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginKeys son las claves que se cuentan para un intento de login.
+func (cfg *apiConfig) loginKeys(r *http.Request, email string) (emailKey, ipKey string) {
+	return "email:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + cfg.clientIP(r)
+}
+
+// loginRetryAfter devuelve cuanto falta para que se levante el bloqueo mas
+// largo de las claves, o 0 si ninguna esta bloqueada.
+func (cfg *apiConfig) loginRetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	locks, err := cfg.db.GetLoginLocks(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, l := range locks {
+		if d := time.Duration(l.RetryAfterSeconds * float64(time.Second)); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// recordLoginFailure suma un fallo al email y a la IP y bloquea las que
+// pasaron el umbral.
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, emailKey, ipKey string) error {
+	for _, k := range []struct {
+		key    string
+		policy lockoutPolicy
+	}{
+		{emailKey, cfg.emailLockout},
+		{ipKey, cfg.ipLockout},
+	} {
+		failures, err := cfg.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key:           k.key,
+			WindowSeconds: loginFailureWindow.Seconds(),
+		})
+		if err != nil {
+			return err
+		}
+		if d := k.policy.delay(int(failures)); d > 0 {
+			if err := cfg.db.LockLogin(ctx, database.LockLoginParams{
+				Key:         k.key,
+				LockSeconds: d.Seconds(),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "too many failed login attempts")
+}
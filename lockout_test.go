@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	p := lockoutPolicy{Threshold: 5, Base: 30 * time.Second, Max: 15 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{5, 0},
+		{6, 30 * time.Second},
+		{7, time.Minute},
+		{8, 2 * time.Minute},
+		{10, 8 * time.Minute},
+		{11, 15 * time.Minute},
+		{1000, 15 * time.Minute},
+	}
+	for _, tc := range tests {
+		if got := p.delay(tc.failures); got != tc.want {
+			t.Errorf("delay(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 198.51.100.7")
+
+	cfg := &apiConfig{}
+	if got := cfg.clientIP(req); got != "192.0.2.1" {
+		t.Errorf("without TRUST_PROXY: %s", got)
+	}
+	cfg.trustProxy = true
+	if got := cfg.clientIP(req); got != "198.51.100.7" {
+		t.Errorf("with TRUST_PROXY: %s", got)
+	}
+}
+
+func TestHandlerLoginLockout(t *testing.T) {
+	hash, err := auth.HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := database.User{ID: uuid.New(), Email: "a@example.com", HashedPassword: hash}
+
+	login := func(t *testing.T, cfg *apiConfig, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":"A@example.com","password":"`+password+`"}`))
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		cfg.handlerLogin(rec, req)
+		return rec
+	}
+
+	t.Run("locked", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetLoginLocks", []driver.Value{"email:a@example.com", 89.2})
+
+		rec := login(t, cfg, "pw")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("status = %d, want 429", rec.Code)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "90" {
+			t.Errorf("Retry-After = %q, want 90", got)
+		}
+		// Ni siquiera se busca el usuario
+		if len(f.called("GetUserEmail")) != 0 {
+			t.Error("GetUserEmail should not run while locked")
+		}
+		keys := f.called("GetLoginLocks")[0][0].(string)
+		if !strings.Contains(keys, "email:a@example.com") || !strings.Contains(keys, "ip:192.0.2.1") {
+			t.Errorf("GetLoginLocks keys = %s", keys)
+		}
+	})
+
+	t.Run("failure locks after threshold", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetLoginLocks")
+		f.returns("GetUserEmail", userRow(user))
+		f.on("RecordLoginFailure", func(args []driver.Value) ([][]driver.Value, error) {
+			// El email ya va por el sexto fallo, la IP por el primero
+			if args[0] == "email:a@example.com" {
+				return [][]driver.Value{{int64(6)}}, nil
+			}
+			return [][]driver.Value{{int64(1)}}, nil
+		})
+		f.returns("LockLogin")
+
+		rec := login(t, cfg, "wrong")
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", rec.Code)
+		}
+		if n := len(f.called("RecordLoginFailure")); n != 2 {
+			t.Errorf("RecordLoginFailure called %d times, want 2", n)
+		}
+		locks := f.called("LockLogin")
+		if len(locks) != 1 || locks[0][0] != "email:a@example.com" {
+			t.Fatalf("LockLogin calls = %v", locks)
+		}
+		if locks[0][1] != float64(30) {
+			t.Errorf("locked for %vs, want 30s", locks[0][1])
+		}
+	})
+
+	t.Run("unknown email counts too", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetLoginLocks")
+		f.returns("GetUserEmail")
+		f.returns("RecordLoginFailure", []driver.Value{int64(1)})
+
+		if rec := login(t, cfg, "pw"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", rec.Code)
+		}
+		if n := len(f.called("RecordLoginFailure")); n != 2 {
+			t.Errorf("RecordLoginFailure called %d times, want 2", n)
+		}
+	})
+
+	t.Run("success resets counters", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetLoginLocks")
+		f.returns("GetUserEmail", userRow(user))
+		f.returns("ClearLoginFailures")
+		f.returns("GetUserTOTP")
+		returnsNewToken(f, user.ID)
+
+		if rec := login(t, cfg, "pw"); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+		}
+		calls := f.called("ClearLoginFailures")
+		if len(calls) != 1 || !strings.Contains(calls[0][0].(string), "email:a@example.com") || !strings.Contains(calls[0][0].(string), "ip:192.0.2.1") {
+			t.Errorf("ClearLoginFailures calls = %v", calls)
+		}
+	})
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"os/signal"
 	"sync/atomic"
-	 _ "github.com/lib/pq"	
+	"syscall"
+	 "github.com/lib/pq"	
 	 "github.com/google/uuid"
 	 "github.com/joho/godotenv"
 	 "database/sql"
@@ -16,17 +21,49 @@ import (
 	 "time"
 	 "errors"
 	 "github.com/bootdotdev/learn-http-servers/internal/auth"
+	 "github.com/bootdotdev/learn-http-servers/internal/chirptext"
+	 "github.com/bootdotdev/learn-http-servers/internal/moderation"
+	 "github.com/bootdotdev/learn-http-servers/internal/mailer"
+	 "github.com/bootdotdev/learn-http-servers/internal/oidc"
+	 "github.com/bootdotdev/learn-http-servers/internal/ratelimit"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
     db *database.Queries	
+	sqlDB *sql.DB
 	platform string
-	secret string
+	jwtKeys *auth.KeySet
+	polkaKey string
+	// bloqueos de login por email y por IP
+	emailLockout lockoutPolicy
+	ipLockout    lockoutPolicy
+	// X-Forwarded-For solo se cree detras de un proxy propio
+	trustProxy bool
+	trendingWindows []time.Duration
+	// moderator revisa cada chirp; wordlist es la parte que se edita desde /admin
+	moderator moderation.Filter
+	wordlist  *moderation.Wordlist
+	fileRules []moderation.Rule
+	// mails de verificacion; appBaseURL arma el link que va en el mail
+	mailer     mailer.Mailer
+	appBaseURL string
+	// cola de los mails de reset de password, que salen despues de responder
+	// (ver startPasswordResets)
+	passwordResets chan string
+	// si esta prendido solo las cuentas verificadas pueden postear
+	requireVerifiedEmail bool
+	// rate limiting: nil en rateLimiter lo apaga
+	rateLimiter     ratelimit.Store
+	globalRateLimit ratelimit.Limit
+	routeRateLimits map[string]ratelimit.Limit
+	// "Sign in with": proveedores OpenID Connect por nombre
+	oidcProviders map[string]*oidc.Provider
 }
 
 type chirpRequest struct {
-	Body string `json:"body"`
+	Body     string     `json:"body"`
+	ParentID *uuid.UUID `json:"parent_id"`
 }
 
 type loginRequest struct {
@@ -49,6 +86,10 @@ type User struct {
 	Email     string    `json:"email"`
 	Token     string    `json:"token"`
 	RefreshToken string `json:"refresh_token"`
+	IsChirpyRed  bool   `json:"is_chirpy_red"`
+	Handle       string `json:"handle,omitempty"`
+	Role         string `json:"role,omitempty"`
+	IsVerified   bool   `json:"is_verified"`
 }
 
 type reqCreateUser struct {
@@ -62,14 +103,31 @@ type chirpResponse struct {
     UpdatedAt time.Time `json:"updated_at"`
     Body      string    `json:"body"`
     UserID    uuid.UUID `json:"user_id"`
+    ParentID  *uuid.UUID `json:"parent_id"`
+    ReplyCount int64    `json:"reply_count"`
+    LikeCount  int64    `json:"like_count"`
+    // Solo viene si el request trae un bearer valido
+    LikedByMe  *bool    `json:"liked_by_me,omitempty"`
+}
+
+type chirpsPageResponse struct {
+	Chirps     []chirpResponse `json:"chirps"`
+	NextCursor string          `json:"next_cursor,omitempty"`
 }
 
 type reqUpdateUser struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// nil deja el handle como esta, "" lo borra
+	Handle *string `json:"handle"`
 }
 
 func main() {
+	// -promote-admin=<email>: le da el rol admin a esa cuenta (con el email
+	// verificado) y sale sin levantar el server. Es para tener el primer admin.
+	promoteAdminEmail := flag.String("promote-admin", "", "promote the verified account with this email to admin and exit")
+	flag.Parse()
+
 	// BD
 	// Se carga el ENV
 	if err := godotenv.Load(); err != nil {
@@ -86,16 +144,121 @@ func main() {
 	// Se crean las queries
 	dbQueries := database.New(db)
 
+	if *promoteAdminEmail != "" {
+		if err := promoteAdmin(context.Background(), dbQueries, *promoteAdminEmail); err != nil {
+			log.Fatalf("error promoting admin: %v", err)
+		}
+		log.Printf("%s is now an admin", *promoteAdminEmail)
+		return
+	}
+
+	// Keys de los JWT: SECRET (HS256, legacy) y/o JWT_SIGNING_KEYS, una lista
+	// de PEMs separados por coma. La primera private key es la que firma.
+	jwtKeys, err := auth.LoadKeySet(os.Getenv("SECRET"), splitList(os.Getenv("JWT_SIGNING_KEYS")))
+	if err != nil {
+		log.Fatalf("error loading JWT keys: %v", err)
+	}
+
+	// Ventanas permitidas para /api/hashtags/trending (la primera es la default)
+	trendingWindows, err := parseDurations(splitList(envOr("TRENDING_WINDOWS", "24h,1h,168h")))
+	if err != nil {
+		log.Fatalf("invalid TRENDING_WINDOWS: %v", err)
+	}
+
+	// Moderacion: las reglas de MODERATION_WORDLIST (si hay) y encima las de la DB
+	var fileRules []moderation.Rule
+	if path := os.Getenv("MODERATION_WORDLIST"); path != "" {
+		fileRules, err = moderation.LoadFile(path)
+		if err != nil {
+			log.Fatalf("error loading moderation wordlist: %v", err)
+		}
+	}
+	wordlist, err := moderation.NewWordlist(fileRules)
+	if err != nil {
+		log.Fatalf("invalid moderation wordlist: %v", err)
+	}
+
+	// Mails: SMTP_ADDR manda de verdad; si no, MAIL_FILE o el log (desarrollo)
+	mailFrom := envOr("MAIL_FROM", "Chirpy <no-reply@localhost>")
+	var appMailer mailer.Mailer
+	switch {
+	case os.Getenv("SMTP_ADDR") != "":
+		appMailer = &mailer.SMTP{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     mailFrom,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case os.Getenv("MAIL_FILE") != "":
+		appMailer, err = mailer.OpenFile(mailFrom, os.Getenv("MAIL_FILE"))
+		if err != nil {
+			log.Fatalf("error opening MAIL_FILE: %v", err)
+		}
+	default:
+		appMailer = mailer.NewWriter(mailFrom, log.Writer())
+	}
+
+	// Rate limiting: RATE_LIMIT_STORE=memory (default), postgres u off.
+	// RATE_LIMIT_GLOBAL es "n/period" y RATE_LIMITS "patron=n/period;..."
+	var rateLimiter ratelimit.Store
+	switch store := envOr("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		rateLimiter = ratelimit.NewMemory()
+	case "postgres":
+		rateLimiter = ratelimit.NewPostgres(dbQueries)
+	case "off":
+	default:
+		log.Fatalf("invalid RATE_LIMIT_STORE: %q", store)
+	}
+	globalRateLimit, err := ratelimit.ParseLimit(envOr("RATE_LIMIT_GLOBAL", "300/1m"))
+	if err != nil {
+		log.Fatalf("invalid RATE_LIMIT_GLOBAL: %v", err)
+	}
+	routeRateLimits, err := ratelimit.ParseRouteLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		log.Fatalf("invalid RATE_LIMITS: %v", err)
+	}
+	for pattern, l := range defaultRouteRateLimits {
+		if _, ok := routeRateLimits[pattern]; !ok {
+			routeRateLimits[pattern] = l
+		}
+	}
+
 		// after creating dbQueries:
 	apiCfg := &apiConfig{
 		db:       dbQueries,
+		sqlDB:    db,
+		trendingWindows: trendingWindows,
 		platform: os.Getenv("PLATFORM"),
-		secret:   os.Getenv("SECRET"),
+		jwtKeys:  jwtKeys,
+		polkaKey: os.Getenv("POLKA_KEY"),
+		moderator: wordlist,
+		wordlist:  wordlist,
+		fileRules: fileRules,
+		mailer:    appMailer,
+		appBaseURL: envOr("APP_BASE_URL", "http://localhost:8080"),
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		emailLockout: defaultEmailLockout,
+		ipLockout:    defaultIPLockout,
+		trustProxy:   os.Getenv("TRUST_PROXY") == "true",
+		rateLimiter:     rateLimiter,
+		globalRateLimit: globalRateLimit,
+		routeRateLimits: routeRateLimits,
+	}
+	apiCfg.oidcProviders, err = loadOIDCProviders(apiCfg.appBaseURL)
+	if err != nil {
+		log.Fatalf("error loading OIDC providers: %v", err)
+	}
+	if err := apiCfg.reloadModerationRules(context.Background()); err != nil {
+		log.Fatalf("error loading moderation rules: %v", err)
 	}
+	go apiCfg.watchModerationRules(context.Background(), moderationReloadInterval)
 
 //	apiCfg := &apiConfig{}
 
 	const port = "8080"
+	// Lo que se espera a los requests en curso al apagar
+	const shutdownTimeout = 30 * time.Second
 
 	mux := http.NewServeMux()
 
@@ -112,16 +275,40 @@ func main() {
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(handler))
 
 	// 3. Admin metrics (HTML)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerAdminMetrics)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminMetrics))
 
-	// 4. Admin reset
+	// 4. Admin reset (solo en dev: borra todos los usuarios, admins incluidos)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerAdminReset)
 
+	// 4b. Admin moderacion (wordlists)
+	mux.HandleFunc("GET /admin/moderation/rules", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminListModerationRules))
+	mux.HandleFunc("PUT /admin/moderation/rules/{word}", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminPutModerationRule))
+	mux.HandleFunc("DELETE /admin/moderation/rules/{word}", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminDeleteModerationRule))
+
+	// 4c. Cola de reportes (moderadores)
+	mux.HandleFunc("GET /admin/reports", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerAdminListReports))
+	mux.HandleFunc("POST /admin/reports/{chirpID}/resolve", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerAdminResolveReport))
+	mux.HandleFunc("GET /admin/moderation/decisions", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerAdminListDecisions))
+	mux.HandleFunc("DELETE /admin/users/{userID}/suspension", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerAdminUnsuspendUser))
+
+	// 4d. Roles
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminGrantRole))
+	mux.HandleFunc("DELETE /admin/users/{userID}/role", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminRevokeRole))
+
 	// 5. Chirp validation + cleaning
 //	mux.HandleFunc("POST /api/validate_chirp", apiCfg.handlerValidateChirp)
 	
 	// 6. Get user
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
+	// 6b. Verificacion de email
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerUsersVerify)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerUsersResendVerification)
+	// 6c. Reset de password
+	mux.HandleFunc("POST /api/password-reset/request", apiCfg.handlerPasswordResetRequest)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.handlerPasswordResetConfirm)
+	// 6d. 2FA (TOTP)
+	mux.HandleFunc("POST /api/users/2fa/enroll", apiCfg.handlerTwoFactorEnroll)
+	mux.HandleFunc("POST /api/users/2fa/confirm", apiCfg.handlerTwoFactorConfirm)
 
 	// 7. Handle create
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirps)
@@ -129,25 +316,108 @@ func main() {
 	// 8. Handle consult all
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
 
+	// 8b. Busqueda full-text
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.handlerSearchChirps)
+
 	// 9. Get chirp by id
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirpById)
 
+	// 9b. Delete chirp (solo el autor)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
+
+	// 9c. Hilo de respuestas
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerGetChirpThread)
+
+	// 9d. Likes
+	mux.HandleFunc("PUT /api/chirps/{chirpID}/like", apiCfg.handlerLikeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.handlerUnlikeChirp)
+
+	// 9e. Hashtags
+	mux.HandleFunc("GET /api/hashtags/trending", apiCfg.handlerTrendingHashtags)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.handlerGetHashtagChirps)
+	// 9f. Reportes
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", apiCfg.handlerReportChirp)
+
 	// 10. Login
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.handlerLoginTwoFactor)
+	// 10b. Login con proveedores OpenID Connect (OIDC_PROVIDERS)
+	mux.HandleFunc("GET /api/login/oidc/{provider}", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", apiCfg.handlerOIDCCallback)
+	mux.HandleFunc("POST /api/login/oidc/exchange", apiCfg.handlerOIDCExchange)
 	// 11. Handlers para el refresh token
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	// 11b. Sesiones (una por familia de refresh tokens)
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerListSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.handlerRevokeSession)
+	mux.HandleFunc("DELETE /api/sessions", apiCfg.handlerRevokeAllSessions)
+	// 11c. API keys personales (bots e integraciones)
+	mux.HandleFunc("POST /api/keys", apiCfg.handlerCreateAPIKey)
+	mux.HandleFunc("GET /api/keys", apiCfg.handlerListAPIKeys)
+	mux.HandleFunc("DELETE /api/keys/{keyID}", apiCfg.handlerRevokeAPIKey)
+	// 11d. OAuth 2.0 para apps de terceros: registro de clientes, consentimiento
+	// (la pantalla la arma el frontend) y los endpoints de tokens de los clientes
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.handlerOAuthCreateClient)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.handlerOAuthListClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.handlerOAuthDeleteClient)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handlerOAuthAuthorizeStart)
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.handlerOAuthAuthorizeInfo)
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /api/oauth/introspect", apiCfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /api/oauth/revoke", apiCfg.handlerOAuthRevoke)
+	// Las apps que autorizo el usuario
+	mux.HandleFunc("GET /api/oauth/grants", apiCfg.handlerOAuthListGrants)
+	mux.HandleFunc("DELETE /api/oauth/grants/{grantID}", apiCfg.handlerOAuthRevokeGrant)
+	// JWKS con las public keys para que otros servicios validen nuestros tokens
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+
 	//11. Update user
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("PUT /api/users/handle", apiCfg.handlerUsersSetHandle)
+	// 12. Follows y timeline
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollow)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerUnfollow)
+	mux.HandleFunc("GET /api/timeline", apiCfg.handlerTimeline)
+	// 12b. Menciones
+	mux.HandleFunc("GET /api/mentions", apiCfg.handlerMentions)
+
+	// 13. Webhook de Polka (Chirpy Red)
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhook)
+
+	// 14. Rate limiting para todo el mux
+	if apiCfg.rateLimiter != nil {
+		go apiCfg.sweepRateLimits(context.Background(), 10*time.Minute)
+	}
 
 	// Server setup
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: apiCfg.middlewareRateLimit(mux),
 	}
 
-	log.Printf("Serving on port: %s\n", port)
-	log.Fatal(srv.ListenAndServe())
+	stopPasswordResets := apiCfg.startPasswordResets(passwordResetWorkers, passwordResetQueueSize)
+
+	// Con SIGINT o SIGTERM se deja de aceptar requests, se terminan los que
+	// estan en curso y se mandan los mails que quedaron en la cola
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		log.Printf("Serving on port: %s\n", port)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error shutting down: %v", err)
+	}
+	stopPasswordResets()
 }
 
 // Middleware para contar hits
@@ -209,6 +479,11 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
         return
 	}
 
+	if !validEmail(req.Email) {
+		respondWithError(w, http.StatusBadRequest, "invalid email")
+		return
+	}
+
 	if strings.TrimSpace(req.Password) == ""{
 		respondWithError(w, http.StatusBadRequest, "password required")
         return
@@ -234,7 +509,16 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 	res = User{ID: dbUser.ID, 
 			    CreatedAt: dbUser.CreatedAt, 
 				UpdatedAt: dbUser.UpdatedAt, 
-				Email: dbUser.Email }
+				Email: dbUser.Email,
+				IsChirpyRed: dbUser.IsChirpyRed,
+				Handle: dbUser.Handle.String,
+				Role: dbUser.Role,
+				IsVerified: dbUser.VerifiedAt.Valid }
+
+	// Si el mail falla la cuenta queda igual; se puede pedir otro con /api/users/verify/resend
+	if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+		log.Printf("could not send verification email to %s: %v", dbUser.ID, err)
+	}
 
 	respondWithJSON(w, http.StatusCreated, res)
 
@@ -243,19 +527,23 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 
 // Handler para /api/chirps
 func (cfg *apiConfig) handlerChirps(w http.ResponseWriter, r *http.Request) {
-	// Buscamos el bearer si lo tiene
-	tokenStr, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "unauthorized")
-        return
-    }
+	// Autenticamos (access token o API key con chirps:write)
+	userId, ok := cfg.requireUser(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
 
-	// Validamos el JWT y obtenemos el user
-    userId, err := auth.ValidateJWT(tokenStr, cfg.secret)
-    if err != nil {
-        respondWithError(w, http.StatusUnauthorized, "unauthorized")
-        return
-    }
+	// Con REQUIRE_VERIFIED_EMAIL solo postean las cuentas verificadas
+	if cfg.requireVerifiedEmail {
+		if err := cfg.checkVerified(r.Context(), userId); err != nil {
+			if errors.Is(err, errEmailNotVerified) {
+				respondWithError(w, http.StatusForbidden, "email not verified")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "could not get user")
+			return
+		}
+	}
 
 	// Leemos la peticion para recupera el chirp
 	var req chirpRequest
@@ -268,52 +556,138 @@ func (cfg *apiConfig) handlerChirps(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
 		return
 	}
+	// Si es una respuesta, el chirp padre tiene que existir
+	var parentID uuid.NullUUID
+	if req.ParentID != nil {
+		parent, err := cfg.db.GetChirp(r.Context(), *req.ParentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, http.StatusNotFound, "parent chirp not found")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "could not get parent chirp")
+			return
+		}
+		if parent.HiddenAt.Valid {
+			respondWithError(w, http.StatusNotFound, "parent chirp not found")
+			return
+		}
+		parentID = uuid.NullUUID{UUID: *req.ParentID, Valid: true}
+	}
+	// Moderacion: se enmascara, se rechaza o se marca para revision
+	verdict := cfg.moderator.Check(req.Body)
+	if verdict.Rejected() {
+		respondWithError(w, http.StatusBadRequest, "chirp rejected by moderation")
+		return
+	}
 	// Parametros para SQL
 	params := database.CreateChirpParams{
-		Body:   cleanChirp(req.Body),
+		Body:   verdict.Body,
 		UserID: userId, 
+		ParentID: parentID,
 	}
-	// Se crea el registro en la DB. 
-	dbChirp, err := cfg.db.CreateChirp(r.Context(), params)
+	// Se crea el registro en la DB junto con sus hashtags y menciones (sobre el body ya limpio)
+	var dbChirp database.Chirp
+	var err error
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		dbChirp, err = q.CreateChirp(r.Context(), params)
+		if err != nil {
+			return err
+		}
+		if tags := chirptext.ExtractHashtags(dbChirp.Body); len(tags) > 0 {
+			err = q.AddChirpHashtags(r.Context(), database.AddChirpHashtagsParams{
+				ChirpID: dbChirp.ID,
+				Tags:    tags,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if handles := chirptext.ExtractMentions(dbChirp.Body); len(handles) > 0 {
+			err = q.AddChirpMentions(r.Context(), database.AddChirpMentionsParams{
+				ChirpID: dbChirp.ID,
+				Handles: handles,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		// Los chirps marcados entran a la cola de moderacion como reporte automatico
+		if verdict.Flagged() {
+			_, err = q.CreateReport(r.Context(), database.CreateReportParams{
+				ChirpID: dbChirp.ID,
+				Reason:  "flagged words: " + strings.Join(flaggedWords(verdict), ", "),
+			})
+			return err
+		}
+		return nil
+	})
     if err != nil {
+		// CreateChirp no inserta nada si el autor esta suspendido
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusForbidden, "account suspended")
+			return
+		}
         respondWithError(w, http.StatusInternalServerError, "could not create chirp")
         return
     }
 
-	// after dbChirp is created:
-	resp := chirpResponse{
-		ID: dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body: dbChirp.Body,
-		UserID: dbChirp.UserID,
-	}
+	// after dbChirp is created (recien creado, no tiene respuestas):
+	resp := newChirpResponse(dbChirp)
 
 
 	respondWithJSON(w, http.StatusCreated, resp)
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	dbChirps, err := cfg.db.GetChirps(r.Context())
+	// Pedimos uno extra para saber si hay otra pagina
+	params := database.GetChirpsParams{PageLimit: page.Limit + 1}
+
+	// Filtro opcional por autor
+	if authorID := r.URL.Query().Get("author_id"); authorID != "" {
+		uid, err := uuid.Parse(authorID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid author_id")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+
+	// Orden: asc (default) o desc
+	switch r.URL.Query().Get("sort") {
+	case "", "asc":
+	case "desc":
+		params.Descending = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "sort must be asc or desc")
+		return
+	}
+
+	if page.Cursor != nil {
+		params.AfterCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	dbChirps, err := cfg.db.GetChirps(r.Context(), params)
     if err != nil {
         respondWithError(w, http.StatusInternalServerError, "could get chirps")
         return
     }
 
-	out := make([]chirpResponse, 0, len(dbChirps))
-		for _, c := range dbChirps {
-			out = append(out, chirpResponse{
-				ID:        c.ID,
-				CreatedAt: c.CreatedAt,
-				UpdatedAt: c.UpdatedAt,
-				Body:      c.Body,
-				UserID:    c.UserID,
-			})
-		}
-
-
-	respondWithJSON(w, http.StatusOK, out)
+	res, err := cfg.newChirpsPage(r.Context(), dbChirps, page.Limit, cfg.viewerID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could get chirps")
+		return
+	}
+	// El body sigue siendo el array de siempre; la pagina siguiente va en Link
+	setNextPageLink(w, r, res.NextCursor)
+	respondWithJSON(w, http.StatusOK, res.Chirps)
 }
 
 func (cfg *apiConfig) handlerGetChirpById(w http.ResponseWriter, r *http.Request) {
@@ -336,32 +710,84 @@ func (cfg *apiConfig) handlerGetChirpById(w http.ResponseWriter, r *http.Request
 			respondWithError(w, http.StatusInternalServerError, "could not get chirp")
 			return
 		}
+		// Los chirps ocultos por moderacion no se muestran
+		if dbChirp.HiddenAt.Valid {
+			respondWithError(w, http.StatusNotFound, "chirp not found")
+			return
+		}
 
 		// after dbChirp is retrieved:
-		resp := chirpResponse{
-			ID: dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body: dbChirp.Body,
-			UserID: dbChirp.UserID,
+		resp, err := cfg.chirpResponses(r.Context(), []database.Chirp{dbChirp}, cfg.viewerID(r))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not get chirp")
+			return
 		}
 
-		respondWithJSON(w, http.StatusOK, resp)
+		respondWithJSON(w, http.StatusOK, resp[0])
 	} 
 }
 
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	// Autenticamos (access token o API key)
+	userID, ok := cfg.requireUser(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirpID")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "chirp not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get chirp")
+		return
+	}
+
+	// Solo el autor puede borrar su chirp
+	if dbChirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if err := cfg.db.DeleteChirp(r.Context(), chirpID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not delete chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
-	var res User
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Something went wrong")
 		return
 	}
 
+	// Bloqueo por fuerza bruta: se chequea antes de gastar un bcrypt
+	emailKey, ipKey := cfg.loginKeys(r, req.Email)
+	wait, err := cfg.loginRetryAfter(r.Context(), emailKey, ipKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving user")
+		return
+	}
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+
 	dbUser, err := cfg.db.GetUserEmail(r.Context(), req.Email)
 	if err != nil { 
 		if errors.Is(err, sql.ErrNoRows) { // si el error es que no encontro nada
+			cfg.loginFailed(r.Context(), emailKey, ipKey)
 			respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 			return
 		}
@@ -373,50 +799,101 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 
 	err = auth.CheckPasswordHash(req.Password, dbUser.HashedPassword)
 	if err != nil {
+		cfg.loginFailed(r.Context(), emailKey, ipKey)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
         return
 	}
-	
-	// Buscamos el token en el AUTH 
-	token, err := auth.MakeJWT(dbUser.ID, cfg.secret, time.Hour)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "could not create token")
-        return
+
+	// Password correcta: los contadores vuelven a cero
+	if err := cfg.db.ClearLoginFailures(r.Context(), []string{emailKey, ipKey}); err != nil {
+		log.Printf("could not clear login failures: %v", err)
 	}
 
-	// Parseamos el token random  
-	refreshToken, err := auth.MakeRefreshToken()
+	cfg.completeLogin(w, r, dbUser)
+}
+
+// completeLogin sigue un login ya autenticado (con password o con un
+// proveedor OIDC): rechaza cuentas suspendidas y, con 2FA activo, devuelve el
+// challenge en vez de los tokens.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	if dbUser.SuspendedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "account suspended")
+		return
+	}
+
+	// Con 2FA activo no hay tokens todavia: se sigue en /api/login/2fa
+	totp, err := cfg.db.GetUserTOTP(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving user")
+		return
+	}
+	if err == nil && totp.ConfirmedAt.Valid {
+		challenge, err := cfg.createLoginChallenge(r.Context(), dbUser.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not create login challenge")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	res, err := cfg.issueTokens(r, dbUser)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "could not create refresh token")
+		respondWithError(w, http.StatusInternalServerError, "could not create tokens")
 		return
 	}
 
-	// se vence en 60 dias
-	refreshExpiresAt := time.Now().Add(24 * time.Hour * 60)
+	respondWithJSON(w, http.StatusOK, res)
+}
 
-	// Parametros para crear
-	createParams := database.CreateTokenParams{
-		Token:     refreshToken,
-		UserID:    dbUser.ID,
-		ExpiresAt: refreshExpiresAt,
+// loginFailed registra el fallo; si no se puede, el login sigue respondiendo 401.
+func (cfg *apiConfig) loginFailed(ctx context.Context, emailKey, ipKey string) {
+	if err := cfg.recordLoginFailure(ctx, emailKey, ipKey); err != nil {
+		log.Printf("could not record login failure: %v", err)
 	}
+}
 
-	// Guardamos el token en BD
-	dbRefreshToken, err := cfg.db.CreateToken(r.Context(), createParams)
+// issueTokens crea el access token y una familia nueva de refresh tokens:
+// es el final de un login, con o sin segundo factor. La familia es la sesion
+// que se ve en /api/sessions, con el dispositivo de r.
+func (cfg *apiConfig) issueTokens(r *http.Request, dbUser database.User) (User, error) {
+	// Buscamos el token en el AUTH
+	token, err := cfg.jwtKeys.MakeJWT(dbUser.ID, auth.Role(dbUser.Role), time.Hour)
 	if err != nil {
-		// If conflict on primary key (very unlikely), return error
-		respondWithError(w, http.StatusInternalServerError, "could not persist refresh token")
-		return
+		return User{}, err
 	}
 
-	res = User{ID: dbUser.ID, 
-			   CreatedAt: dbUser.CreatedAt, 
-			   UpdatedAt: dbUser.UpdatedAt, 
-			   Email: dbUser.Email,
-			   Token: token,
-			   RefreshToken: dbRefreshToken.Token }
+	// Parseamos el token random
+	refreshToken, err := auth.MakePrefixedToken(auth.RefreshTokenPrefix)
+	if err != nil {
+		return User{}, err
+	}
 
-	respondWithJSON(w, http.StatusOK, res)
+	// Guardamos el hash del token en BD, se vence en 60 dias
+	_, err = cfg.db.CreateToken(r.Context(), database.CreateTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(24 * time.Hour * 60),
+		FamilyID:  uuid.New(), // cada login empieza una familia nueva
+		UserAgent: sessionUserAgent(r),
+		Ip:        cfg.clientIP(r),
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{
+		ID:           dbUser.ID,
+		CreatedAt:    dbUser.CreatedAt,
+		UpdatedAt:    dbUser.UpdatedAt,
+		Email:        dbUser.Email,
+		Token:        token,
+		RefreshToken: refreshToken,
+		IsChirpyRed:  dbUser.IsChirpyRed,
+		Handle:       dbUser.Handle.String,
+		Role:         dbUser.Role,
+		IsVerified:   dbUser.VerifiedAt.Valid,
+	}, nil
 }
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
@@ -427,10 +904,11 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// lookup token in DB
-	row, err := cfg.db.GetUserFromRefreshToken(r.Context(), tokenStr)
+	// lookup token in DB (tambien los revocados, para detectar reuso).
+	// En la DB esta solo el hash.
+	tokenHash := auth.HashToken(tokenStr)
+	row, err := cfg.db.GetRefreshToken(r.Context(), tokenHash)
 	if err != nil {
-		// not found or other error -> unauthorized
 		if errors.Is(err, sql.ErrNoRows) {
 			respondWithError(w, http.StatusUnauthorized, "invalid refresh token")
 			return
@@ -439,9 +917,10 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check revoked
+	// Un token ya rotado que vuelve a aparecer probablemente fue robado:
+	// se revoca toda la familia.
 	if row.RevokedAt.Valid {
-		respondWithError(w, http.StatusUnauthorized, "refresh token revoked")
+		cfg.revokeRefreshFamily(w, r, row.FamilyID)
 		return
 	}
 
@@ -451,21 +930,78 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// row should include user id in whatever sqlc generated struct you have.
-	// I assume sqlc returned user's id as row.ID (because of SELECT users.id).
-	userID := row.ID
+	// Nuevo refresh token en la misma familia, con el mismo vencimiento
+	newRefreshToken, err := auth.MakePrefixedToken(auth.RefreshTokenPrefix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create refresh token")
+		return
+	}
+
+	// Revocar el actual y crear el nuevo van juntos: si el insert falla el
+	// cliente reintenta con el mismo token y no parece un reuso. Si otro
+	// request lo roto primero, el claim no devuelve filas y es reuso.
+	var claimed database.RefreshToken
+	var dbUser database.User
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		claimed, err = q.ClaimRefreshToken(r.Context(), tokenHash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errRefreshTokenReused
+			}
+			return err
+		}
+		// El rol se vuelve a leer en cada refresh, asi un cambio de rol llega
+		// al proximo access token
+		if dbUser, err = q.GetUserByID(r.Context(), claimed.UserID); err != nil {
+			return err
+		}
+		_, err = q.CreateToken(r.Context(), database.CreateTokenParams{
+			TokenHash: auth.HashToken(newRefreshToken),
+			UserID:    claimed.UserID,
+			ExpiresAt: claimed.ExpiresAt,
+			FamilyID:  claimed.FamilyID,
+			// La sesion pasa a mostrar el ultimo dispositivo que la uso
+			UserAgent: sessionUserAgent(r),
+			Ip:        cfg.clientIP(r),
+		})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errRefreshTokenReused) {
+			cfg.revokeRefreshFamily(w, r, row.FamilyID)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not rotate refresh token")
+		return
+	}
 
 	// Create new access token (1 hour)
-	newAccessToken, err := auth.MakeJWT(userID, cfg.secret, time.Hour)
+	newAccessToken, err := cfg.jwtKeys.MakeJWT(claimed.UserID, auth.Role(dbUser.Role), time.Hour)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not create access token")
 		return
 	}
 
-	resp := map[string]string{"token": newAccessToken}
+	resp := map[string]string{
+		"token":         newAccessToken,
+		"refresh_token": newRefreshToken,
+	}
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// revokeRefreshFamily corta todas las sesiones derivadas del mismo login.
+func (cfg *apiConfig) revokeRefreshFamily(w http.ResponseWriter, r *http.Request, familyID uuid.UUID) {
+	if err := cfg.db.RevokeTokenFamily(r.Context(), familyID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not revoke refresh tokens")
+		return
+	}
+	log.Printf("refresh token reuse detected for family %s", familyID)
+	respondWithError(w, http.StatusUnauthorized, "refresh token revoked")
+}
+
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	tokenStr, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -474,7 +1010,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update DB to revoke it
-	if err := cfg.db.RevokeToken(r.Context(), tokenStr); err != nil {
+	if err := cfg.db.RevokeToken(r.Context(), auth.HashToken(tokenStr)); err != nil {
 		// If token not found, treat as 401 (or you could return 204 to avoid token probing)
 		if errors.Is(err, sql.ErrNoRows) {
 			respondWithError(w, http.StatusUnauthorized, "invalid refresh token")
@@ -490,21 +1026,14 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 
 
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
-	// 1. Obtener bearer token
-	tokenStr, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized")
-		return
-	}
-
-	// 2. Validar JWT y obtener el userID
-	userID, err := auth.ValidateJWT(tokenStr, cfg.secret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized")
+	// 1. Autenticar: cambia email y password, asi que solo con un login (ni
+	// API keys ni clientes OAuth, aunque tengan profile:write)
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
 		return
 	}
 
-	// 3. Parsear body
+	// 2. Parsear body
 	var req reqUpdateUser
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "invalid JSON")
@@ -515,39 +1044,245 @@ func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "email and password required")
 		return
 	}
+	if !validEmail(req.Email) {
+		respondWithError(w, http.StatusBadRequest, "invalid email")
+		return
+	}
+
+	var handle sql.NullString
+	if req.Handle != nil {
+		if *req.Handle != "" && !chirptext.ValidHandle(*req.Handle) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("handle must be 1-%d letters, digits or underscores", chirptext.MaxHandleLength))
+			return
+		}
+		handle = sql.NullString{String: *req.Handle, Valid: true}
+	}
 
-	// 4. Hashear password
+	// 3. Hashear password
 	hash, err := auth.HashPassword(req.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not hash password")
 		return
 	}
 
-	// 5. Update en DB
+	// 4. Update en DB
 	params := database.UpdateUserParams{
 		ID:             userID,
 		Email:          req.Email,
 		HashedPassword: hash,
+		Handle:         handle,
 	}
 
 	dbUser, err := cfg.db.UpdateUser(r.Context(), params)
 	if err != nil {
+		if isUniqueViolation(err, "users_handle_lower_idx") {
+			respondWithError(w, http.StatusConflict, "handle already taken")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "could not update user")
 		return
 	}
 
-	// 6. Responder (sin password)
+	// 5. Responder (sin password)
 	res := User{
 		ID:        dbUser.ID,
 		CreatedAt: dbUser.CreatedAt,
 		UpdatedAt: dbUser.UpdatedAt,
 		Email:     dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		Handle:    dbUser.Handle.String,
+		Role:      dbUser.Role,
+		IsVerified: dbUser.VerifiedAt.Valid,
+	}
+
+	// Un email nuevo vuelve la cuenta a no verificada: le mandamos otro token
+	if !dbUser.VerifiedAt.Valid {
+		if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+			log.Printf("could not send verification email to %s: %v", dbUser.ID, err)
+		}
 	}
 	respondWithJSON(w, http.StatusOK, res)
 }
 
+type reqSetHandle struct {
+	// "" borra el handle
+	Handle string `json:"handle"`
+}
+
+// PUT /api/users/handle: cambia solo el handle. Esto si se puede con una API
+// key o un cliente OAuth con profile:write.
+func (cfg *apiConfig) handlerUsersSetHandle(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, auth.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	var req reqSetHandle
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Handle != "" && !chirptext.ValidHandle(req.Handle) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("handle must be 1-%d letters, digits or underscores", chirptext.MaxHandleLength))
+		return
+	}
+
+	dbUser, err := cfg.db.SetUserHandle(r.Context(), database.SetUserHandleParams{
+		ID:     userID,
+		Handle: req.Handle,
+	})
+	if err != nil {
+		if isUniqueViolation(err, "users_handle_lower_idx") {
+			respondWithError(w, http.StatusConflict, "handle already taken")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not update user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		Handle:      dbUser.Handle.String,
+		Role:        dbUser.Role,
+		IsVerified:  dbUser.VerifiedAt.Valid,
+	})
+}
+
+type polkaWebhookRequest struct {
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+	} `json:"data"`
+}
+
+func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	// Polka se autentica con "Authorization: ApiKey <key>"
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil || cfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req polkaWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	// Ignoramos cualquier otro evento
+	if req.Event != "user.upgraded" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if _, err := cfg.db.UpgradeUserToChirpyRed(r.Context(), req.Data.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not upgrade user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
+
 // --- helpers ---
 
+// isUniqueViolation dice si err es una violacion del indice unico constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// withTx corre fn dentro de una transaccion; si fn devuelve error se hace rollback.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(cfg.db.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// viewerID devuelve el usuario del bearer token (o API key con chirps:read)
+// si viene uno valido. Para los endpoints publicos: sin token (o con uno
+// invalido) se responde como anonimo.
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.NullUUID {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+func newChirpResponse(c database.Chirp) chirpResponse {
+	resp := chirpResponse{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserID:    c.UserID,
+	}
+	if c.ParentID.Valid {
+		parentID := c.ParentID.UUID
+		resp.ParentID = &parentID
+	}
+	return resp
+}
+
+// chirpResponses convierte los chirps y les agrega los contadores con una
+// sola query para toda la lista (sin N+1). Si hay viewer tambien se llena
+// liked_by_me.
+func (cfg *apiConfig) chirpResponses(ctx context.Context, chirps []database.Chirp, viewer uuid.NullUUID) ([]chirpResponse, error) {
+	out := make([]chirpResponse, 0, len(chirps))
+	if len(chirps) == 0 {
+		return out, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+	stats, err := cfg.db.GetChirpStats(ctx, database.GetChirpStatsParams{
+		ViewerID: viewer,
+		Ids:      ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]database.GetChirpStatsRow, len(stats))
+	for _, st := range stats {
+		byID[st.ID] = st
+	}
+
+	for _, c := range chirps {
+		st := byID[c.ID]
+		resp := newChirpResponse(c)
+		resp.ReplyCount = st.ReplyCount
+		resp.LikeCount = st.LikeCount
+		if viewer.Valid {
+			likedByMe := st.LikedByMe
+			resp.LikedByMe = &likedByMe
+		}
+		out = append(out, resp)
+	}
+	return out, nil
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string) {
 	respondWithJSON(w, code, errorResponse{Error: msg})
 }
@@ -559,18 +1294,39 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(data)
 }
 
-func cleanChirp(body string) string {
-	profane := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+// splitList separa una lista por comas ignorando espacios y elementos vacios.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
+	return out
+}
 
-	words := strings.Split(body, " ")
-	for i, w := range words {
-		if _, found := profane[strings.ToLower(w)]; found {
-			words[i] = "****"
+// envOr devuelve la variable de entorno o el default si no esta seteada.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func parseDurations(items []string) ([]time.Duration, error) {
+	out := make([]time.Duration, 0, len(items))
+	for _, item := range items {
+		d, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
 		}
+		if d <= 0 {
+			return nil, fmt.Errorf("duration must be positive: %s", item)
+		}
+		out = append(out, d)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no durations given")
 	}
-	return strings.Join(words, " ")
+	return out, nil
 }
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/mailer"
+	"github.com/bootdotdev/learn-http-servers/internal/moderation"
+	"github.com/google/uuid"
+)
+
+// fakeDB is a tiny database/sql driver that routes each sqlc query, by the
+// "-- name:" marker sqlc keeps at the top of the SQL, to a handler registered
+// by the test. Handlers return the raw rows the query would produce.
+type fakeDB struct {
+	t        *testing.T
+	mu       sync.Mutex
+	handlers map[string]fakeHandler
+	calls    map[string][][]driver.Value
+	// roles es el rol de cada usuario para GetUserAccess (user si no esta)
+	roles map[string]string
+}
+
+type fakeHandler func(args []driver.Value) ([][]driver.Value, error)
+
+var queryNameRe = regexp.MustCompile(`-- name: (\w+)`)
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	t.Helper()
+	f := &fakeDB{
+		t:        t,
+		handlers: map[string]fakeHandler{},
+		calls:    map[string][][]driver.Value{},
+		roles:    map[string]string{},
+	}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return f, db
+}
+
+// on registers the rows returned for the named query.
+func (f *fakeDB) on(name string, h fakeHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[name] = h
+}
+
+// returns is a shortcut for handlers that always return the same rows.
+func (f *fakeDB) returns(name string, rows ...[]driver.Value) {
+	f.on(name, func([]driver.Value) ([][]driver.Value, error) { return rows, nil })
+}
+
+// setRole guarda el rol de userID que devuelve el GetUserAccess por defecto.
+func (f *fakeDB) setRole(userID uuid.UUID, role auth.Role) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.roles[userID.String()] = string(role)
+}
+
+func (f *fakeDB) role(userID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if role, ok := f.roles[userID]; ok {
+		return role
+	}
+	return string(auth.RoleUser)
+}
+
+// called returns the arguments of every call to the named query.
+func (f *fakeDB) called(name string) [][]driver.Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[name]
+}
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) ([][]driver.Value, error) {
+	m := queryNameRe.FindStringSubmatch(query)
+	if m == nil {
+		f.t.Errorf("query without sqlc name: %q", query)
+		return nil, errors.New("unnamed query")
+	}
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		args[i] = nv.Value
+	}
+
+	f.mu.Lock()
+	f.calls[m[1]] = append(f.calls[m[1]], args)
+	h, ok := f.handlers[m[1]]
+	f.mu.Unlock()
+	if !ok {
+		f.t.Errorf("unexpected query %s", m[1])
+		return nil, errors.New("unexpected query " + m[1])
+	}
+	return h(args)
+}
+
+// driver.Connector / driver.Driver
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return f }
+func (f *fakeDB) Open(string) (driver.Conn, error)             { return fakeConn{f}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	rows [][]driver.Value
+	i    int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+// fakeMailer guarda los mails en vez de mandarlos.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.sent...)
+}
+
+// --- fixtures ---
+
+const testSecret = "test-secret"
+
+func newTestConfig(t *testing.T) (*apiConfig, *fakeDB) {
+	t.Helper()
+	f, db := newFakeDB(t)
+	keys, err := auth.NewKeySet(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordlist, err := moderation.NewWordlist([]moderation.Rule{
+		{Word: "kerfuffle", Action: moderation.ActionMask},
+		{Word: "sharbert", Action: moderation.ActionMask},
+		{Word: "fornax", Action: moderation.ActionMask},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{
+		db:              database.New(db),
+		sqlDB:           db,
+		jwtKeys:         keys,
+		platform:        "dev",
+		trendingWindows: []time.Duration{24 * time.Hour, time.Hour},
+		moderator:       wordlist,
+		wordlist:        wordlist,
+		mailer:          &fakeMailer{},
+		appBaseURL:      "http://chirpy.test",
+		emailLockout:    defaultEmailLockout,
+		ipLockout:       defaultIPLockout,
+	}
+	// Todo request autenticado mira si la cuenta esta suspendida, y las rutas
+	// de /admin tambien el rol
+	f.returns("IsUserSuspended", []driver.Value{false})
+	f.on("GetUserAccess", func(args []driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{{f.role(args[0].(string)), false}}, nil
+	})
+	return cfg, f
+}
+
+func bearer(t *testing.T, userID uuid.UUID) string {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, testSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// bearerWithRole firma con el KeySet del config, que es el que lleva el rol,
+// y deja el mismo rol en el fakeDB, que es de donde lo lee requireRole.
+func bearerWithRole(t *testing.T, cfg *apiConfig, userID uuid.UUID, role auth.Role) string {
+	t.Helper()
+	if f, ok := cfg.sqlDB.Driver().(*fakeDB); ok {
+		f.setRole(userID, role)
+	}
+	token, err := cfg.jwtKeys.MakeJWT(userID, role, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	return "Bearer " + token
+}
+
+func chirpRow(c database.Chirp) []driver.Value {
+	return []driver.Value{c.ID.String(), c.CreatedAt, c.UpdatedAt, c.Body, c.UserID.String(), nullUUID(c.ParentID), nil, nullTime(c.HiddenAt)}
+}
+
+func nullUUID(u uuid.NullUUID) driver.Value {
+	if !u.Valid {
+		return nil
+	}
+	return u.UUID.String()
+}
+
+func nullTime(t sql.NullTime) driver.Value {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var res errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("decoding error body: %v", err)
+	}
+	return res.Error
+}
+
+func TestHandlerDeleteChirp(t *testing.T) {
+	owner := uuid.New()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Body:      "hello",
+		UserID:    owner,
+	}
+
+	tests := []struct {
+		name       string
+		auth       string
+		chirpID    string
+		setup      func(f *fakeDB)
+		wantStatus int
+		wantDelete bool
+	}{
+		{
+			name:       "missing token",
+			chirpID:    chirp.ID.String(),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token",
+			auth:       "Bearer not-a-jwt",
+			chirpID:    chirp.ID.String(),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid chirp id",
+			auth:       bearer(t, owner),
+			chirpID:    "nope",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "chirp not found",
+			auth:    bearer(t, owner),
+			chirpID: chirp.ID.String(),
+			setup: func(f *fakeDB) {
+				f.returns("GetChirp")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:    "lookup fails",
+			auth:    bearer(t, owner),
+			chirpID: chirp.ID.String(),
+			setup: func(f *fakeDB) {
+				f.on("GetChirp", func([]driver.Value) ([][]driver.Value, error) {
+					return nil, errors.New("boom")
+				})
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:    "not the author",
+			auth:    bearer(t, uuid.New()),
+			chirpID: chirp.ID.String(),
+			setup: func(f *fakeDB) {
+				f.returns("GetChirp", chirpRow(chirp))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:    "delete fails",
+			auth:    bearer(t, owner),
+			chirpID: chirp.ID.String(),
+			setup: func(f *fakeDB) {
+				f.returns("GetChirp", chirpRow(chirp))
+				f.on("DeleteChirp", func([]driver.Value) ([][]driver.Value, error) {
+					return nil, errors.New("boom")
+				})
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantDelete: true,
+		},
+		{
+			name:    "author deletes",
+			auth:    bearer(t, owner),
+			chirpID: chirp.ID.String(),
+			setup: func(f *fakeDB) {
+				f.returns("GetChirp", chirpRow(chirp))
+				f.returns("DeleteChirp")
+			},
+			wantStatus: http.StatusNoContent,
+			wantDelete: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+tc.chirpID, nil)
+			req.SetPathValue("chirpID", tc.chirpID)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+
+			cfg.handlerDeleteChirp(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			deletes := f.called("DeleteChirp")
+			if tc.wantDelete != (len(deletes) == 1) {
+				t.Fatalf("DeleteChirp calls = %d, want delete %v", len(deletes), tc.wantDelete)
+			}
+			if tc.wantDelete && deletes[0][0] != chirp.ID.String() {
+				t.Errorf("deleted %v, want %v", deletes[0][0], chirp.ID)
+			}
+			if rec.Code >= 400 && strings.TrimSpace(decodeError(t, rec)) == "" {
+				t.Errorf("expected an error message")
+			}
+		})
+	}
+}
+
+func userRow(u database.User) []driver.Value {
+	var handle driver.Value
+	if u.Handle.Valid {
+		handle = u.Handle.String
+	}
+	role := u.Role
+	if role == "" {
+		role = string(auth.RoleUser)
+	}
+	return []driver.Value{u.ID.String(), u.CreatedAt, u.UpdatedAt, u.Email, u.HashedPassword, u.IsChirpyRed, handle, nullTime(u.SuspendedAt), role, nullTime(u.VerifiedAt)}
+}
+
+func TestHandlerPolkaWebhook(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "a@example.com", IsChirpyRed: true}
+
+	tests := []struct {
+		name        string
+		auth        string
+		body        string
+		setup       func(f *fakeDB)
+		wantStatus  int
+		wantUpgrade bool
+	}{
+		{
+			name:       "missing key",
+			body:       `{"event":"user.upgraded"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong key",
+			auth:       "ApiKey nope",
+			body:       `{"event":"user.upgraded"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "other event",
+			auth:       "ApiKey polka",
+			body:       `{"event":"user.payment_failed","data":{"user_id":"` + user.ID.String() + `"}}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:        "unknown user",
+			auth:        "ApiKey polka",
+			body:        `{"event":"user.upgraded","data":{"user_id":"` + user.ID.String() + `"}}`,
+			setup:       func(f *fakeDB) { f.returns("UpgradeUserToChirpyRed") },
+			wantStatus:  http.StatusNotFound,
+			wantUpgrade: true,
+		},
+		{
+			name:        "upgrade",
+			auth:        "ApiKey polka",
+			body:        `{"event":"user.upgraded","data":{"user_id":"` + user.ID.String() + `"}}`,
+			setup:       func(f *fakeDB) { f.returns("UpgradeUserToChirpyRed", userRow(user)) },
+			wantStatus:  http.StatusNoContent,
+			wantUpgrade: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			cfg.polkaKey = "polka"
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(tc.body))
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerPolkaWebhook(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if got := len(f.called("UpgradeUserToChirpyRed")) == 1; got != tc.wantUpgrade {
+				t.Errorf("upgrade called = %v, want %v", got, tc.wantUpgrade)
+			}
+		})
+	}
+}
+
+func refreshTokenRow(rt database.RefreshToken) []driver.Value {
+	var revokedAt driver.Value
+	if rt.RevokedAt.Valid {
+		revokedAt = rt.RevokedAt.Time
+	}
+	return []driver.Value{rt.TokenHash, rt.CreatedAt, rt.UpdatedAt, rt.UserID.String(), rt.ExpiresAt, revokedAt, rt.FamilyID.String(), rt.LastUsedAt, rt.UserAgent, rt.Ip}
+}
+
+func TestHandlerRefreshRotation(t *testing.T) {
+	const oldToken = "chirpy_rt_old"
+	active := database.RefreshToken{
+		TokenHash: auth.HashToken(oldToken),
+		UserID:    uuid.New(),
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+		FamilyID:  uuid.New(),
+	}
+	revoked := active
+	revoked.RevokedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	expired := active
+	expired.ExpiresAt = time.Now().UTC().Add(-time.Hour)
+
+	tests := []struct {
+		name             string
+		setup            func(f *fakeDB)
+		wantStatus       int
+		wantFamilyRevoke bool
+		wantNewToken     bool
+	}{
+		{
+			name:       "unknown token",
+			setup:      func(f *fakeDB) { f.returns("GetRefreshToken") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired token",
+			setup:      func(f *fakeDB) { f.returns("GetRefreshToken", refreshTokenRow(expired)) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "reused token revokes the family",
+			setup: func(f *fakeDB) {
+				f.returns("GetRefreshToken", refreshTokenRow(revoked))
+				f.returns("RevokeTokenFamily")
+			},
+			wantStatus:       http.StatusUnauthorized,
+			wantFamilyRevoke: true,
+		},
+		{
+			name: "lost rotation race counts as reuse",
+			setup: func(f *fakeDB) {
+				f.returns("GetRefreshToken", refreshTokenRow(active))
+				f.returns("ClaimRefreshToken")
+				f.returns("RevokeTokenFamily")
+			},
+			wantStatus:       http.StatusUnauthorized,
+			wantFamilyRevoke: true,
+		},
+		{
+			// El claim se deshace con el rollback: el reintento no es reuso
+			name: "failed insert is not reuse",
+			setup: func(f *fakeDB) {
+				f.returns("GetRefreshToken", refreshTokenRow(active))
+				f.returns("ClaimRefreshToken", refreshTokenRow(revoked))
+				f.returns("GetUserByID", userRow(database.User{ID: active.UserID, Email: "a@example.com"}))
+				f.on("CreateToken", func(args []driver.Value) ([][]driver.Value, error) {
+					return nil, errors.New("db down")
+				})
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "rotates",
+			setup: func(f *fakeDB) {
+				f.returns("GetRefreshToken", refreshTokenRow(active))
+				f.returns("ClaimRefreshToken", refreshTokenRow(revoked))
+				f.returns("GetUserByID", userRow(database.User{ID: active.UserID, Email: "a@example.com"}))
+				f.on("CreateToken", func(args []driver.Value) ([][]driver.Value, error) {
+					next := active
+					next.TokenHash = args[0].(string)
+					return [][]driver.Value{refreshTokenRow(next)}, nil
+				})
+			},
+			wantStatus:   http.StatusOK,
+			wantNewToken: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			tc.setup(f)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+			req.Header.Set("Authorization", "Bearer "+oldToken)
+			req.Header.Set("User-Agent", "chirpy-test/1.0")
+			rec := httptest.NewRecorder()
+			cfg.handlerRefresh(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+
+			familyRevokes := f.called("RevokeTokenFamily")
+			if tc.wantFamilyRevoke != (len(familyRevokes) == 1) {
+				t.Fatalf("RevokeTokenFamily calls = %d", len(familyRevokes))
+			}
+			if tc.wantFamilyRevoke && familyRevokes[0][0] != active.FamilyID.String() {
+				t.Errorf("revoked family %v, want %v", familyRevokes[0][0], active.FamilyID)
+			}
+
+			if !tc.wantNewToken {
+				return
+			}
+			created := f.called("CreateToken")
+			if len(created) != 1 {
+				t.Fatalf("CreateToken calls = %d, want 1", len(created))
+			}
+			if created[0][3] != active.FamilyID.String() {
+				t.Errorf("new token family = %v, want %v", created[0][3], active.FamilyID)
+			}
+			// La sesion registra el dispositivo del refresh
+			if created[0][4] != "chirpy-test/1.0" || created[0][5] != "192.0.2.1" {
+				t.Errorf("new token device = %v %v", created[0][4], created[0][5])
+			}
+			var res map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res["token"] == "" || !strings.HasPrefix(res["refresh_token"], auth.RefreshTokenPrefix) || res["refresh_token"] == oldToken {
+				t.Errorf("unexpected response %v", res)
+			}
+			// Solo los hashes llegan a la DB
+			if f.called("GetRefreshToken")[0][0] != active.TokenHash || f.called("ClaimRefreshToken")[0][0] != active.TokenHash {
+				t.Error("refresh token looked up by its raw value")
+			}
+			if created[0][0] != auth.HashToken(res["refresh_token"]) {
+				t.Errorf("stored %v, want the hash of the new token", created[0][0])
+			}
+		})
+	}
+}
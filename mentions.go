@@ -0,0 +1,46 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// GET /api/mentions: chirps que mencionan al usuario, mas nuevos primero
+func (cfg *apiConfig) handlerMentions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.GetMentionsParams{
+		UserID:    userID,
+		PageLimit: page.Limit + 1,
+	}
+	if page.Cursor != nil {
+		params.BeforeCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	dbChirps, err := cfg.db.GetMentions(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get mentions")
+		return
+	}
+
+	res, err := cfg.newChirpsPage(r.Context(), dbChirps, page.Limit, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get mentions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestHandlerUsersUpdateHandle(t *testing.T) {
+	user := database.User{
+		ID:         uuid.New(),
+		Email:      "a@example.com",
+		Handle:     sql.NullString{String: "Ana", Valid: true},
+		VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(f *fakeDB)
+		wantStatus int
+		wantHandle driver.Value
+	}{
+		{
+			name:       "set handle",
+			body:       `{"email":"a@example.com","password":"pw","handle":"Ana"}`,
+			setup:      func(f *fakeDB) { f.returns("UpdateUser", userRow(user)) },
+			wantStatus: http.StatusOK,
+			wantHandle: "Ana",
+		},
+		{
+			name:       "keep handle",
+			body:       `{"email":"a@example.com","password":"pw"}`,
+			setup:      func(f *fakeDB) { f.returns("UpdateUser", userRow(user)) },
+			wantStatus: http.StatusOK,
+			wantHandle: nil,
+		},
+		{
+			name:       "clear handle",
+			body:       `{"email":"a@example.com","password":"pw","handle":""}`,
+			setup:      func(f *fakeDB) { f.returns("UpdateUser", userRow(user)) },
+			wantStatus: http.StatusOK,
+			wantHandle: "",
+		},
+		{
+			name:       "invalid handle",
+			body:       `{"email":"a@example.com","password":"pw","handle":"no spaces"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "handle taken",
+			body: `{"email":"a@example.com","password":"pw","handle":"ANA"}`,
+			setup: func(f *fakeDB) {
+				f.on("UpdateUser", func([]driver.Value) ([][]driver.Value, error) {
+					return nil, &pq.Error{Code: "23505", Constraint: "users_handle_lower_idx"}
+				})
+			},
+			wantStatus: http.StatusConflict,
+			wantHandle: "ANA",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(tc.body))
+			req.Header.Set("Authorization", bearer(t, user.ID))
+			rec := httptest.NewRecorder()
+			cfg.handlerUsersUpdate(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			calls := f.called("UpdateUser")
+			if tc.setup == nil {
+				if len(calls) != 0 {
+					t.Error("UpdateUser should not run on invalid input")
+				}
+				return
+			}
+			if got := calls[0][2]; got != tc.wantHandle {
+				t.Errorf("handle arg = %v, want %v", got, tc.wantHandle)
+			}
+		})
+	}
+}
+
+func TestHandlerUsersSetHandle(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "a@example.com", Handle: sql.NullString{String: "Ana", Valid: true}}
+
+	tests := []struct {
+		name       string
+		auth       string
+		body       string
+		setup      func(f *fakeDB)
+		wantStatus int
+		wantHandle driver.Value
+	}{
+		{
+			name:       "api key with profile:write",
+			auth:       "Bearer " + testAPIKey,
+			body:       `{"handle":"Ana"}`,
+			setup:      func(f *fakeDB) { f.returns("SetUserHandle", userRow(user)) },
+			wantStatus: http.StatusOK,
+			wantHandle: "Ana",
+		},
+		{
+			name:       "clear handle",
+			body:       `{"handle":""}`,
+			setup:      func(f *fakeDB) { f.returns("SetUserHandle", userRow(database.User{ID: user.ID, Email: user.Email})) },
+			wantStatus: http.StatusOK,
+			wantHandle: "",
+		},
+		{name: "invalid handle", body: `{"handle":"no spaces"}`, wantStatus: http.StatusBadRequest},
+		{
+			name: "handle taken",
+			body: `{"handle":"ANA"}`,
+			setup: func(f *fakeDB) {
+				f.on("SetUserHandle", func([]driver.Value) ([][]driver.Value, error) {
+					return nil, &pq.Error{Code: "23505", Constraint: "users_handle_lower_idx"}
+				})
+			},
+			wantStatus: http.StatusConflict,
+			wantHandle: "ANA",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			returnsAPIKey(f, user.ID, `{"profile:write"}`)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/users/handle", strings.NewReader(tc.body))
+			if tc.auth == "" {
+				tc.auth = bearer(t, user.ID)
+			}
+			req.Header.Set("Authorization", tc.auth)
+			rec := httptest.NewRecorder()
+			cfg.handlerUsersSetHandle(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			calls := f.called("SetUserHandle")
+			if tc.setup == nil {
+				if len(calls) != 0 {
+					t.Error("SetUserHandle should not run on invalid input")
+				}
+				return
+			}
+			if calls[0][0] != user.ID.String() || calls[0][1] != tc.wantHandle {
+				t.Errorf("SetUserHandle args = %v", calls[0])
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	author, mentioned := uuid.New(), uuid.New()
+	cfg, f := newTestConfig(t)
+
+	var created database.Chirp
+	f.on("CreateChirp", func(args []driver.Value) ([][]driver.Value, error) {
+		created = database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: args[0].(string), UserID: author}
+		return [][]driver.Value{chirpRow(created)}, nil
+	})
+	f.returns("AddChirpMentions")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hola @Ana y @bob, escribile a carl@example.com"}`))
+	req.Header.Set("Authorization", bearer(t, author))
+	rec := httptest.NewRecorder()
+	cfg.handlerChirps(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	calls := f.called("AddChirpMentions")
+	if len(calls) != 1 || calls[0][0] != created.ID.String() || calls[0][1] != `{"ana","bob"}` {
+		t.Errorf("AddChirpMentions calls = %v", calls)
+	}
+
+	// El feed de menciones es del usuario del token
+	f.returns("GetMentions", chirpRow(created))
+	f.returns("GetChirpStats")
+	req = httptest.NewRequest(http.MethodGet, "/api/mentions", nil)
+	req.Header.Set("Authorization", bearer(t, mentioned))
+	rec = httptest.NewRecorder()
+	cfg.handlerMentions(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := f.called("GetMentions")[0][0]; got != mentioned.String() {
+		t.Errorf("user arg = %v, want %v", got, mentioned)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/mentions", nil)
+	rec = httptest.NewRecorder()
+	cfg.handlerMentions(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
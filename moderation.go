@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/moderation"
+)
+
+// Cada instancia relee las reglas de la DB cada tanto: los cambios del admin
+// se aplican al toque en la que atendio el request y en las demas despues.
+const moderationReloadInterval = 30 * time.Second
+
+type moderationRuleRequest struct {
+	Action string `json:"action"`
+}
+
+// reloadModerationRules vuelve a armar la wordlist: primero las reglas del
+// archivo y despues las de la DB, que pisan a las del archivo.
+func (cfg *apiConfig) reloadModerationRules(ctx context.Context) error {
+	dbRules, err := cfg.db.ListModerationRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]moderation.Rule, 0, len(cfg.fileRules)+len(dbRules))
+	rules = append(rules, cfg.fileRules...)
+	for _, r := range dbRules {
+		rules = append(rules, moderation.Rule{Word: r.Word, Action: moderation.Action(r.Action)})
+	}
+	return cfg.wordlist.SetRules(rules)
+}
+
+// watchModerationRules relee las reglas cada every hasta que se cancele ctx.
+// Si la DB falla se siguen usando las ultimas reglas cargadas.
+func (cfg *apiConfig) watchModerationRules(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.reloadModerationRules(ctx); err != nil {
+				log.Printf("moderation rules reload: %v", err)
+			}
+		}
+	}
+}
+
+// flaggedWords devuelve las palabras que dispararon una regla flag.
+func flaggedWords(res moderation.Result) []string {
+	var words []string
+	for _, m := range res.Matches {
+		if m.Action == moderation.ActionFlag {
+			words = append(words, m.Word)
+		}
+	}
+	return words
+}
+
+// GET /admin/moderation/rules: reglas vigentes (archivo + DB)
+func (cfg *apiConfig) handlerAdminListModerationRules(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, cfg.wordlist.Rules())
+}
+
+// PUT /admin/moderation/rules/{word}: crea o cambia la accion de una palabra
+func (cfg *apiConfig) handlerAdminPutModerationRule(w http.ResponseWriter, r *http.Request) {
+	word, err := moderation.NormalizeWord(r.PathValue("word"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid word")
+		return
+	}
+
+	var req moderationRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	action, err := moderation.ParseAction(req.Action)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "action must be mask, flag or reject")
+		return
+	}
+
+	if _, err := cfg.db.UpsertModerationRule(r.Context(), database.UpsertModerationRuleParams{
+		Word:   word,
+		Action: string(action),
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not save rule")
+		return
+	}
+	if err := cfg.reloadModerationRules(r.Context()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not reload rules")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, moderation.Rule{Word: word, Action: action})
+}
+
+// DELETE /admin/moderation/rules/{word}: solo borra reglas de la DB, las del
+// archivo se sacan editando el archivo.
+func (cfg *apiConfig) handlerAdminDeleteModerationRule(w http.ResponseWriter, r *http.Request) {
+	word, err := moderation.NormalizeWord(r.PathValue("word"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid word")
+		return
+	}
+
+	n, err := cfg.db.DeleteModerationRule(r.Context(), word)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not delete rule")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	if err := cfg.reloadModerationRules(r.Context()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not reload rules")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
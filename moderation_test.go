@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/moderation"
+	"github.com/google/uuid"
+)
+
+func TestHandlerChirpsModeration(t *testing.T) {
+	user := uuid.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantFlag   driver.Value
+	}{
+		{name: "mask with punctuation", body: "What a kerfuffle! Sharbert's fault", wantStatus: http.StatusCreated, wantBody: "What a ****! ****'s fault"},
+		{name: "leetspeak", body: "k3rfuffl3 indeed", wantStatus: http.StatusCreated, wantBody: "**** indeed"},
+		{name: "flag", body: "this is a Zorp", wantStatus: http.StatusCreated, wantBody: "this is a Zorp", wantFlag: "flagged words: Zorp"},
+		{name: "reject", body: "pure blorg", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			rules := append(cfg.wordlist.Rules(),
+				moderation.Rule{Word: "zorp", Action: moderation.ActionFlag},
+				moderation.Rule{Word: "blorg", Action: moderation.ActionReject},
+			)
+			if err := cfg.wordlist.SetRules(rules); err != nil {
+				t.Fatal(err)
+			}
+			f.on("CreateChirp", func(args []driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{chirpRow(database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: args[0].(string), UserID: user})}, nil
+			})
+			f.on("CreateReport", func(args []driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), args[0], args[1], args[2], time.Now(), nil, nil}}, nil
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"`+tc.body+`"}`))
+			req.Header.Set("Authorization", bearer(t, user))
+			rec := httptest.NewRecorder()
+			cfg.handlerChirps(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			creates := f.called("CreateChirp")
+			if tc.wantStatus != http.StatusCreated {
+				if len(creates) != 0 {
+					t.Error("rejected chirp should not be stored")
+				}
+				return
+			}
+			if creates[0][0] != tc.wantBody {
+				t.Errorf("stored body = %q, want %q", creates[0][0], tc.wantBody)
+			}
+			// Los marcados entran a la cola como reporte sin reporter
+			flags := f.called("CreateReport")
+			if tc.wantFlag == nil && len(flags) != 0 {
+				t.Errorf("unexpected CreateReport calls %v", flags)
+			}
+			if tc.wantFlag != nil && (len(flags) != 1 || flags[0][1] != nil || flags[0][2] != tc.wantFlag) {
+				t.Errorf("CreateReport calls = %v, want reason %v", flags, tc.wantFlag)
+			}
+		})
+	}
+}
+
+func TestAdminModerationRules(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	f.returns("UpsertModerationRule", []driver.Value{"zorp", "reject", time.Now(), time.Now()})
+	f.returns("ListModerationRules",
+		[]driver.Value{"kerfuffle", "mask", time.Now(), time.Now()},
+		[]driver.Value{"zorp", "reject", time.Now(), time.Now()},
+	)
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/moderation/rules/Z0rp", strings.NewReader(`{"action":"reject"}`))
+	req.SetPathValue("word", "Z0rp")
+	rec := httptest.NewRecorder()
+	cfg.handlerAdminPutModerationRule(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if args := f.called("UpsertModerationRule")[0]; args[0] != "zorp" || args[1] != "reject" {
+		t.Errorf("UpsertModerationRule args = %v", args)
+	}
+	// La wordlist se recarga sin reiniciar
+	if !cfg.moderator.Check("hey zorp").Rejected() {
+		t.Error("new rule should apply right away")
+	}
+	if cfg.moderator.Check("sharbert").Action != "" {
+		t.Error("rules missing from the DB should be gone after reload")
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/admin/moderation/rules/zorp", strings.NewReader(`{"action":"nuke"}`))
+	req.SetPathValue("word", "zorp")
+	rec = httptest.NewRecorder()
+	cfg.handlerAdminPutModerationRule(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+
+	f.returns("DeleteModerationRule")
+	req = httptest.NewRequest(http.MethodDelete, "/admin/moderation/rules/nope", nil)
+	req.SetPathValue("word", "nope")
+	rec = httptest.NewRecorder()
+	cfg.handlerAdminDeleteModerationRule(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestWatchModerationRules(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	// Otra instancia agrego la regla directo en la DB
+	f.returns("ListModerationRules", []driver.Value{"zorp", "reject", time.Now(), time.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cfg.watchModerationRules(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cfg.moderator.Check("hey zorp").Rejected() {
+		if time.Now().After(deadline) {
+			t.Fatal("rule from the DB was not picked up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	oauthCodeTTL         = 10 * time.Minute
+	maxOAuthRedirectURIs = 10
+	maxOAuthClientName   = 100
+)
+
+// oauthError es un error con el formato de RFC 6749 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func respondOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, status, oauthError{Code: code, Description: description})
+}
+
+type oauthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// Los clientes publicos (apps moviles, SPAs) no tienen secret: no lo
+	// pueden guardar. Se autentican solo con PKCE.
+	Public bool `json:"public"`
+}
+
+type oauthClientResponse struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Solo al registrar: despues no se puede volver a ver
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func newOAuthClientResponse(c database.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Public:       !c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// validRedirectURI acepta https, http solo a loopback (apps de escritorio,
+// RFC 8252 7.3) y esquemas propios con punto (com.example.app:/cb). Sin
+// fragmento, porque el codigo va en la query.
+func validRedirectURI(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || strings.Contains(s, "#") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
+
+// POST /api/oauth/clients: registra una app de terceros del usuario
+func (cfg *apiConfig) handlerOAuthCreateClient(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req oauthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxOAuthClientName {
+		respondWithError(w, http.StatusBadRequest, "name is required (max 100 characters)")
+		return
+	}
+	if len(req.RedirectURIs) == 0 || len(req.RedirectURIs) > maxOAuthRedirectURIs {
+		respondWithError(w, http.StatusBadRequest, "between 1 and 10 redirect_uris are required")
+		return
+	}
+	for _, u := range req.RedirectURIs {
+		if !validRedirectURI(u) {
+			respondWithError(w, http.StatusBadRequest, "invalid redirect_uri: "+u)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if !req.Public {
+		var err error
+		secret, err = auth.MakePrefixedToken(auth.ClientSecretPrefix)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not create client")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         req.Name,
+		SecretHash:   secretHash,
+		RedirectUris: req.RedirectURIs,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create client")
+		return
+	}
+
+	resp := newOAuthClientResponse(client)
+	resp.ClientSecret = secret
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// GET /api/oauth/clients: las apps que registro el usuario
+func (cfg *apiConfig) handlerOAuthListClients(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	clients, err := cfg.db.ListUserOAuthClients(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not list clients")
+		return
+	}
+
+	resp := make([]oauthClientResponse, 0, len(clients))
+	for _, c := range clients {
+		resp = append(resp, newOAuthClientResponse(c))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// DELETE /api/oauth/clients/{clientID}: borra la app y, en cascada, todos los
+// tokens que tenga
+func (cfg *apiConfig) handlerOAuthDeleteClient(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid clientID")
+		return
+	}
+
+	n, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not delete client")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "client not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Una autorizacion (grant) es lo que el usuario aprobo para una app: el ID
+// sobrevive a las rotaciones del refresh token, como el de una sesion.
+type oauthGrantResponse struct {
+	ID           uuid.UUID `json:"id"`
+	ClientID     uuid.UUID `json:"client_id"`
+	ClientName   string    `json:"client_name"`
+	Scopes       []string  `json:"scopes"`
+	AuthorizedAt time.Time `json:"authorized_at"`
+	LastUsedAt   time.Time `json:"last_used_at"`
+}
+
+// GET /api/oauth/grants: las apps que el usuario autorizo
+func (cfg *apiConfig) handlerOAuthListGrants(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListUserOAuthGrants(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not list grants")
+		return
+	}
+
+	grants := make([]oauthGrantResponse, 0, len(rows))
+	for _, row := range rows {
+		grants = append(grants, oauthGrantResponse{
+			ID:           row.GrantID,
+			ClientID:     row.ClientID,
+			ClientName:   row.ClientName,
+			Scopes:       row.Scopes,
+			AuthorizedAt: row.AuthorizedAt,
+			LastUsedAt:   row.LastUsedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, grants)
+}
+
+// DELETE /api/oauth/grants/{grantID}: le saca el acceso a una app. Sus access
+// tokens dejan de servir enseguida (se chequea el grant en cada request).
+func (cfg *apiConfig) handlerOAuthRevokeGrant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	grantID, err := uuid.Parse(r.PathValue("grantID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid grantID")
+		return
+	}
+
+	// Filtra por usuario: el grant de otro da 404 igual que uno que no existe
+	n, err := cfg.db.RevokeUserOAuthGrant(r.Context(), database.RevokeUserOAuthGrantParams{
+		UserID:  userID,
+		GrantID: grantID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not revoke grant")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "grant not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeRequest es un pedido de autorizacion ya validado.
+type authorizeRequest struct {
+	client          database.OauthClient
+	redirectURI     string
+	redirectURISent bool
+	scopes          []string
+	state           string
+	challenge       string
+}
+
+// parseAuthorizeRequest valida los parametros del authorize
+// (RFC 6749 4.1.1 con PKCE obligatorio, solo S256). Si falla el cliente o el
+// redirect_uri, el error devuelto trae req.redirectURI vacio y no se puede
+// mandar al cliente; los demas vuelven por el redirect_uri (4.1.2.1).
+func (cfg *apiConfig) parseAuthorizeRequest(ctx context.Context, q url.Values) (authorizeRequest, *oauthError, error) {
+	var req authorizeRequest
+
+	clientID, err := uuid.Parse(q.Get("client_id"))
+	if err != nil {
+		return req, &oauthError{Code: "invalid_request", Description: "invalid client_id"}, nil
+	}
+	req.client, err = cfg.db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return req, &oauthError{Code: "invalid_request", Description: "unknown client_id"}, nil
+		}
+		return req, nil, err
+	}
+
+	// El redirect_uri tiene que ser uno de los registrados, tal cual. Si el
+	// cliente registro uno solo se puede omitir.
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" && len(req.client.RedirectUris) == 1 {
+		redirectURI = req.client.RedirectUris[0]
+	}
+	if !slices.Contains(req.client.RedirectUris, redirectURI) {
+		return req, &oauthError{Code: "invalid_request", Description: "redirect_uri not registered for this client"}, nil
+	}
+	req.redirectURI = redirectURI
+	req.redirectURISent = q.Get("redirect_uri") != ""
+	req.state = q.Get("state")
+
+	if q.Get("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type"}, nil
+	}
+	scopes, err := auth.ParseScopes(strings.Fields(q.Get("scope")))
+	if err != nil {
+		return req, &oauthError{Code: "invalid_scope", Description: err.Error()}, nil
+	}
+	for _, s := range scopes {
+		req.scopes = append(req.scopes, string(s))
+	}
+	if q.Get("code_challenge_method") != "S256" || !auth.ValidPKCEValue(q.Get("code_challenge")) {
+		return req, &oauthError{Code: "invalid_request", Description: "code_challenge with code_challenge_method S256 is required"}, nil
+	}
+	req.challenge = q.Get("code_challenge")
+	return req, nil, nil
+}
+
+// authorizeRedirect agrega params (code o error, y state) al redirect_uri.
+func authorizeRedirect(req authorizeRequest, params url.Values) string {
+	u, _ := url.Parse(req.redirectURI) // ya validado contra los registrados
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if req.state != "" {
+		q.Set("state", req.state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+type authorizeConsentResponse struct {
+	ClientID    uuid.UUID `json:"client_id"`
+	ClientName  string    `json:"client_name"`
+	RedirectURI string    `json:"redirect_uri"`
+	Scopes      []string  `json:"scopes"`
+	State       string    `json:"state,omitempty"`
+}
+
+// El frontend navega a redirect_to: con el codigo o con el error para el cliente
+type authorizeRedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// respondAuthorizeError muestra el error si no hay a donde mandarlo o
+// devuelve el redirect con el error para el cliente.
+func respondAuthorizeError(w http.ResponseWriter, req authorizeRequest, oerr *oauthError) {
+	if req.redirectURI == "" {
+		respondOAuthError(w, http.StatusBadRequest, oerr.Code, oerr.Description)
+		return
+	}
+	params := url.Values{"error": {oerr.Code}}
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	respondWithJSON(w, http.StatusOK, authorizeRedirectResponse{RedirectTo: authorizeRedirect(req, params)})
+}
+
+// GET /oauth/authorize: el authorization endpoint al que las apps mandan al
+// navegador del usuario. No hay sesion con cookie: valida el pedido y pasa
+// la query tal cual a la pantalla de consentimiento del frontend
+// (<APP_BASE_URL>/app/oauth/authorize), que ya tiene el access token del
+// usuario (o lo manda a loguearse y vuelve). Esa pantalla llama a
+// GET /api/oauth/authorize para mostrar el pedido, manda la decision al POST
+// con el token en Authorization y navega al redirect_to de la respuesta. Como
+// el navegador no agrega ese header solo, otra pagina no puede aprobar en
+// nombre del usuario y no hace falta un token CSRF.
+func (cfg *apiConfig) handlerOAuthAuthorizeStart(w http.ResponseWriter, r *http.Request) {
+	req, oerr, err := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get client")
+		return
+	}
+	if oerr != nil {
+		// Con un redirect_uri valido el error vuelve a la app (4.1.2.1)
+		if req.redirectURI == "" {
+			respondOAuthError(w, http.StatusBadRequest, oerr.Code, oerr.Description)
+			return
+		}
+		params := url.Values{"error": {oerr.Code}}
+		if oerr.Description != "" {
+			params.Set("error_description", oerr.Description)
+		}
+		http.Redirect(w, r, authorizeRedirect(req, params), http.StatusFound)
+		return
+	}
+
+	link := strings.TrimRight(cfg.appBaseURL, "/") + "/app/oauth/authorize?" + r.URL.RawQuery
+	http.Redirect(w, r, link, http.StatusFound)
+}
+
+// GET /api/oauth/authorize: valida el pedido de la app y devuelve lo que la
+// pantalla de consentimiento le muestra al usuario logueado. La pantalla
+// recibe la query del cliente tal cual y la reenvia aca y al POST.
+func (cfg *apiConfig) handlerOAuthAuthorizeInfo(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireUser(w, r, loginOnly); !ok {
+		return
+	}
+
+	req, oerr, err := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get client")
+		return
+	}
+	if oerr != nil {
+		respondAuthorizeError(w, req, oerr)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, authorizeConsentResponse{
+		ClientID:    req.client.ID,
+		ClientName:  req.client.Name,
+		RedirectURI: req.redirectURI,
+		Scopes:      req.scopes,
+		State:       req.state,
+	})
+}
+
+type authorizeDecisionRequest struct {
+	Approve bool `json:"approve"`
+}
+
+// POST /api/oauth/authorize: la respuesta del usuario en la pantalla de
+// consentimiento. Si aprueba se crea el codigo; si no, access_denied.
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	req, oerr, err := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get client")
+		return
+	}
+	if oerr != nil {
+		respondAuthorizeError(w, req, oerr)
+		return
+	}
+
+	var decision authorizeDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if !decision.Approve {
+		respondAuthorizeError(w, req, &oauthError{Code: "access_denied"})
+		return
+	}
+
+	code, err := auth.MakePrefixedToken(auth.AuthorizationCodePrefix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create authorization code")
+		return
+	}
+	err = cfg.db.CreateOAuthCode(r.Context(), database.CreateOAuthCodeParams{
+		CodeHash:        auth.HashToken(code),
+		ClientID:        req.client.ID,
+		UserID:          userID,
+		GrantID:         uuid.New(),
+		RedirectUri:     req.redirectURI,
+		RedirectUriSent: req.redirectURISent,
+		Scopes:          req.scopes,
+		CodeChallenge:   req.challenge,
+		ExpiresAt:       time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create authorization code")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, authorizeRedirectResponse{
+		RedirectTo: authorizeRedirect(req, url.Values{"code": {code}}),
+	})
+}
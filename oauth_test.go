@@ -0,0 +1,829 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// fakeOAuthStore guarda clientes, codigos y tokens en memoria para que el
+// flujo completo corra contra el fakeDB.
+type fakeOAuthStore struct {
+	mu        sync.Mutex
+	clients   map[string][]driver.Value
+	codes     map[string][]driver.Value
+	tokens    map[string][]driver.Value
+	suspended map[string]bool
+}
+
+// suspend marca la cuenta como suspendida para IsUserSuspended.
+func (s *fakeOAuthStore) suspend(userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suspended[userID.String()] = true
+}
+
+func newFakeOAuthStore(f *fakeDB) *fakeOAuthStore {
+	s := &fakeOAuthStore{
+		clients:   map[string][]driver.Value{},
+		codes:     map[string][]driver.Value{},
+		tokens:    map[string][]driver.Value{},
+		suspended: map[string]bool{},
+	}
+	lookup := func(m map[string][]driver.Value) fakeHandler {
+		return func(args []driver.Value) ([][]driver.Value, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if row, ok := m[args[0].(string)]; ok {
+				return [][]driver.Value{row}, nil
+			}
+			return nil, nil
+		}
+	}
+
+	f.on("CreateOAuthClient", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		row := []driver.Value{uuid.NewString(), args[0], args[1], args[2], args[3], time.Now()}
+		s.clients[row[0].(string)] = row
+		return [][]driver.Value{row}, nil
+	})
+	f.on("GetOAuthClient", lookup(s.clients))
+	f.on("CreateOAuthCode", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.codes[args[0].(string)] = []driver.Value{args[0], args[1], args[2], args[3], args[4], args[6], args[7], time.Now(), args[8], nil, args[5]}
+		return nil, nil
+	})
+	f.on("ConsumeOAuthCode", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		row, ok := s.codes[args[0].(string)]
+		if !ok || row[9] != nil || time.Now().After(row[8].(time.Time)) {
+			return nil, nil
+		}
+		row[9] = time.Now()
+		return [][]driver.Value{row}, nil
+	})
+	f.on("GetOAuthCode", lookup(s.codes))
+	f.on("CreateOAuthToken", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.tokens[args[0].(string)] = []driver.Value{args[0], args[1], args[2], args[3], args[4], time.Now(), args[5], nil}
+		return nil, nil
+	})
+	f.on("GetOAuthToken", lookup(s.tokens))
+	f.on("ClaimOAuthToken", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		row, ok := s.tokens[args[0].(string)]
+		if !ok || row[7] != nil {
+			return nil, nil
+		}
+		row[7] = time.Now()
+		return [][]driver.Value{row}, nil
+	})
+	f.on("RevokeOAuthGrant", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, row := range s.tokens {
+			if row[1] == args[0] && row[7] == nil {
+				row[7] = time.Now()
+			}
+		}
+		return nil, nil
+	})
+	f.on("IsOAuthGrantActive", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, row := range s.tokens {
+			if row[1] == args[0] && row[7] == nil && time.Now().Before(row[6].(time.Time)) && !s.suspended[row[3].(string)] {
+				return [][]driver.Value{{true}}, nil
+			}
+		}
+		return [][]driver.Value{{false}}, nil
+	})
+	f.on("ListUserOAuthGrants", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var rows [][]driver.Value
+		for _, row := range s.tokens {
+			if row[3] == args[0] && row[7] == nil {
+				rows = append(rows, []driver.Value{row[1], row[2], s.clients[row[2].(string)][2], row[4], row[5], row[5]})
+			}
+		}
+		return rows, nil
+	})
+	f.on("RevokeUserOAuthGrant", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var revoked [][]driver.Value
+		for _, row := range s.tokens {
+			if row[3] == args[0] && row[1] == args[1] && row[7] == nil {
+				row[7] = time.Now()
+				revoked = append(revoked, row)
+			}
+		}
+		return revoked, nil
+	})
+	f.on("RevokeUserOAuthGrants", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, row := range s.codes {
+			if row[2] == args[0] && row[9] == nil {
+				row[9] = time.Now()
+			}
+		}
+		for _, row := range s.tokens {
+			if row[3] == args[0] && row[7] == nil {
+				row[7] = time.Now()
+			}
+		}
+		return nil, nil
+	})
+	f.returns("RevokeUserTokens")
+	f.on("IsUserSuspended", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return [][]driver.Value{{s.suspended[args[0].(string)]}}, nil
+	})
+	return s
+}
+
+// newOAuthTestServer levanta las rutas de OAuth, DELETE /api/sessions y dos
+// rutas con scope (leer el timeline y postear chirps) sobre un fakeDB con
+// estado.
+func newOAuthTestServer(t *testing.T) (*apiConfig, *fakeOAuthStore, *httptest.Server) {
+	t.Helper()
+	cfg, f := newTestConfig(t)
+	store := newFakeOAuthStore(f)
+	f.returns("GetTimeline")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/oauth/clients", cfg.handlerOAuthCreateClient)
+	mux.HandleFunc("GET /api/oauth/clients", cfg.handlerOAuthListClients)
+	mux.HandleFunc("GET /oauth/authorize", cfg.handlerOAuthAuthorizeStart)
+	mux.HandleFunc("GET /api/oauth/authorize", cfg.handlerOAuthAuthorizeInfo)
+	mux.HandleFunc("POST /api/oauth/authorize", cfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /api/oauth/token", cfg.handlerOAuthToken)
+	mux.HandleFunc("POST /api/oauth/introspect", cfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /api/oauth/revoke", cfg.handlerOAuthRevoke)
+	mux.HandleFunc("GET /api/oauth/grants", cfg.handlerOAuthListGrants)
+	mux.HandleFunc("DELETE /api/oauth/grants/{grantID}", cfg.handlerOAuthRevokeGrant)
+	mux.HandleFunc("DELETE /api/sessions", cfg.handlerRevokeAllSessions)
+	mux.HandleFunc("GET /api/timeline", cfg.handlerTimeline)
+	mux.HandleFunc("POST /api/chirps", cfg.handlerChirps)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return cfg, store, srv
+}
+
+type oauthTestClient struct {
+	id     string
+	secret string
+}
+
+// do manda un request y decodifica la respuesta JSON en out (si no es nil).
+func do(t *testing.T, req *http.Request, out any) *http.Response {
+	t.Helper()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("decoding %s %s: %v", req.Method, req.URL.Path, err)
+		}
+	}
+	return res
+}
+
+func registerOAuthClient(t *testing.T, srv *httptest.Server, owner uuid.UUID, public bool) oauthTestClient {
+	t.Helper()
+	body := `{"name":"Chirpy Desktop","redirect_uris":["` + testRedirectURI + `"],"public":` + strconv.FormatBool(public) + `}`
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/oauth/clients", strings.NewReader(body))
+	req.Header.Set("Authorization", bearer(t, owner))
+	var res oauthClientResponse
+	if r := do(t, req, &res); r.StatusCode != http.StatusCreated {
+		t.Fatalf("register client: status %d", r.StatusCode)
+	}
+	return oauthTestClient{id: res.ClientID.String(), secret: res.ClientSecret}
+}
+
+func authorizeQuery(client oauthTestClient, scope string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.id},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {auth.PKCEChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// authorize aprueba el pedido como userID y devuelve la URL a la que vuelve
+// el usuario.
+func authorize(t *testing.T, srv *httptest.Server, userID uuid.UUID, q url.Values, approve bool) *url.URL {
+	t.Helper()
+	body := `{"approve":false}`
+	if approve {
+		body = `{"approve":true}`
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/oauth/authorize?"+q.Encode(), strings.NewReader(body))
+	req.Header.Set("Authorization", bearer(t, userID))
+	var res authorizeRedirectResponse
+	if r := do(t, req, &res); r.StatusCode != http.StatusOK {
+		t.Fatalf("authorize: status %d", r.StatusCode)
+	}
+	u, err := url.Parse(res.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func postOAuthForm(t *testing.T, srv *httptest.Server, path string, client oauthTestClient, form url.Values, out any) *http.Response {
+	t.Helper()
+	if client.secret == "" {
+		form.Set("client_id", client.id)
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client.secret != "" {
+		req.SetBasicAuth(client.id, client.secret)
+	}
+	return do(t, req, out)
+}
+
+func exchangeCode(t *testing.T, srv *httptest.Server, client oauthTestClient, code string) (oauthTokenResponse, *http.Response) {
+	t.Helper()
+	var tokens oauthTokenResponse
+	res := postOAuthForm(t, srv, "/api/oauth/token", client, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	}, &tokens)
+	return tokens, res
+}
+
+func getWithToken(t *testing.T, srv *httptest.Server, path, token string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return do(t, req, nil).StatusCode
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	_, store, srv := newOAuthTestServer(t)
+	owner, user := uuid.New(), uuid.New()
+
+	// 1. El desarrollador registra la app; el secret sale una sola vez
+	client := registerOAuthClient(t, srv, owner, false)
+	if !strings.HasPrefix(client.secret, auth.ClientSecretPrefix) {
+		t.Fatalf("client_secret = %q", client.secret)
+	}
+	if stored := store.clients[client.id][3]; stored != auth.HashToken(client.secret) {
+		t.Errorf("secret stored as %v", stored)
+	}
+
+	// 2. La pantalla de consentimiento pide los datos del pedido
+	q := authorizeQuery(client, "chirps:read")
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/oauth/authorize?"+q.Encode(), nil)
+	req.Header.Set("Authorization", bearer(t, user))
+	var consent authorizeConsentResponse
+	if res := do(t, req, &consent); res.StatusCode != http.StatusOK {
+		t.Fatalf("consent: status %d", res.StatusCode)
+	}
+	if consent.ClientName != "Chirpy Desktop" || len(consent.Scopes) != 1 || consent.Scopes[0] != "chirps:read" || consent.State != "xyz" {
+		t.Errorf("consent = %+v", consent)
+	}
+
+	// 3. El usuario aprueba y vuelve a la app con el codigo
+	redirect := authorize(t, srv, user, q, true)
+	code := redirect.Query().Get("code")
+	if redirect.Host != "app.example.com" || redirect.Query().Get("state") != "xyz" || !strings.HasPrefix(code, auth.AuthorizationCodePrefix) {
+		t.Fatalf("redirect = %s", redirect)
+	}
+
+	// 4. La app canjea el codigo con el verifier
+	tokens, res := exchangeCode(t, srv, client, code)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("token: status %d", res.StatusCode)
+	}
+	if res.Header.Get("Cache-Control") != "no-store" || tokens.TokenType != "Bearer" || tokens.Scope != "chirps:read" || tokens.ExpiresIn != 3600 {
+		t.Errorf("tokens = %+v, Cache-Control = %q", tokens, res.Header.Get("Cache-Control"))
+	}
+
+	// 5. El access token sirve para lo que cubre su scope y nada mas
+	if status := getWithToken(t, srv, "/api/timeline", tokens.AccessToken); status != http.StatusOK {
+		t.Errorf("timeline with chirps:read: status %d", status)
+	}
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/api/chirps", strings.NewReader(`{"body":"hi"}`))
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	if res := do(t, req, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("post chirp without chirps:write: status %d", res.StatusCode)
+	}
+	if status := getWithToken(t, srv, "/api/oauth/clients", tokens.AccessToken); status != http.StatusForbidden {
+		t.Errorf("account route with a client token: status %d", status)
+	}
+
+	// 6. Refresh: el token rota y el viejo deja de servir
+	var refreshed oauthTokenResponse
+	res = postOAuthForm(t, srv, "/api/oauth/token", client, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}, &refreshed)
+	if res.StatusCode != http.StatusOK || refreshed.RefreshToken == tokens.RefreshToken || refreshed.Scope != "chirps:read" {
+		t.Fatalf("refresh: status %d, %+v", res.StatusCode, refreshed)
+	}
+
+	// 7. Introspection del access token nuevo
+	var info introspectionResponse
+	postOAuthForm(t, srv, "/api/oauth/introspect", client, url.Values{"token": {refreshed.AccessToken}}, &info)
+	if !info.Active || info.Sub != user.String() || info.ClientID != client.id || info.Scope != "chirps:read" || info.TokenType != "Bearer" {
+		t.Errorf("introspect access token = %+v", info)
+	}
+	info = introspectionResponse{}
+	postOAuthForm(t, srv, "/api/oauth/introspect", client, url.Values{"token": {tokens.RefreshToken}}, &info)
+	if info.Active {
+		t.Errorf("rotated refresh token is active: %+v", info)
+	}
+
+	// 8. Otro cliente no ve los tokens de este
+	other := registerOAuthClient(t, srv, owner, true)
+	info = introspectionResponse{}
+	postOAuthForm(t, srv, "/api/oauth/introspect", other, url.Values{"token": {refreshed.AccessToken}}, &info)
+	if info.Active {
+		t.Errorf("another client introspected the token: %+v", info)
+	}
+
+	// 9. Revocar el refresh token corta tambien el access token
+	if res := postOAuthForm(t, srv, "/api/oauth/revoke", client, url.Values{"token": {refreshed.RefreshToken}}, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: status %d", res.StatusCode)
+	}
+	info = introspectionResponse{}
+	postOAuthForm(t, srv, "/api/oauth/introspect", client, url.Values{"token": {refreshed.AccessToken}}, &info)
+	if info.Active {
+		t.Errorf("access token active after revoke: %+v", info)
+	}
+	if status := getWithToken(t, srv, "/api/timeline", refreshed.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("timeline after revoke: status %d", status)
+	}
+}
+
+func TestOAuthTokenExchangeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		public     bool
+		form       func(code string) url.Values
+		secret     string
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name: "wrong code_verifier",
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testRedirectURI}, "code_verifier": {strings.Repeat("a", 43)}}
+			},
+			wantStatus: http.StatusBadRequest, wantError: "invalid_grant",
+		},
+		{
+			name: "no code_verifier",
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testRedirectURI}}
+			},
+			wantStatus: http.StatusBadRequest, wantError: "invalid_grant",
+		},
+		{
+			name: "different redirect_uri",
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://evil.example.com/cb"}, "code_verifier": {testCodeVerifier}}
+			},
+			wantStatus: http.StatusBadRequest, wantError: "invalid_grant",
+		},
+		{
+			name: "redirect_uri sent at authorize but not here",
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "code_verifier": {testCodeVerifier}}
+			},
+			wantStatus: http.StatusBadRequest, wantError: "invalid_grant",
+		},
+		{
+			name: "wrong client secret",
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "code_verifier": {testCodeVerifier}}
+			},
+			secret:     auth.ClientSecretPrefix + "nope",
+			wantStatus: http.StatusUnauthorized, wantError: "invalid_client",
+		},
+		{
+			name:   "public client with a secret",
+			public: true,
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "code_verifier": {testCodeVerifier}, "client_secret": {"x"}}
+			},
+			wantStatus: http.StatusUnauthorized, wantError: "invalid_client",
+		},
+		{
+			name: "unknown grant_type",
+			form: func(code string) url.Values {
+				return url.Values{"grant_type": {"password"}}
+			},
+			wantStatus: http.StatusBadRequest, wantError: "unsupported_grant_type",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, store, srv := newOAuthTestServer(t)
+			client := registerOAuthClient(t, srv, uuid.New(), tc.public)
+			code := authorize(t, srv, uuid.New(), authorizeQuery(client, "chirps:read"), true).Query().Get("code")
+			if tc.secret != "" {
+				client.secret = tc.secret
+			}
+
+			var res oauthError
+			r := postOAuthForm(t, srv, "/api/oauth/token", client, tc.form(code), &res)
+			if r.StatusCode != tc.wantStatus || res.Code != tc.wantError {
+				t.Errorf("status = %d, error = %q, want %d %q", r.StatusCode, res.Code, tc.wantStatus, tc.wantError)
+			}
+			if len(store.tokens) != 0 {
+				t.Errorf("%d tokens issued", len(store.tokens))
+			}
+
+			// Un canje rechazado no gasta el codigo: el cliente puede reintentar
+			if tc.wantError == "invalid_grant" {
+				if _, res := exchangeCode(t, srv, client, code); res.StatusCode != http.StatusOK {
+					t.Errorf("retry after a failed exchange: status %d", res.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthPublicClientFlow(t *testing.T) {
+	_, _, srv := newOAuthTestServer(t)
+	client := registerOAuthClient(t, srv, uuid.New(), true)
+	if client.secret != "" {
+		t.Fatalf("public client got a secret")
+	}
+
+	code := authorize(t, srv, uuid.New(), authorizeQuery(client, "chirps:read chirps:write"), true).Query().Get("code")
+	tokens, res := exchangeCode(t, srv, client, code)
+	if res.StatusCode != http.StatusOK || tokens.Scope != "chirps:read chirps:write" {
+		t.Errorf("status = %d, tokens = %+v", res.StatusCode, tokens)
+	}
+}
+
+func TestOAuthRedirectURIOmitted(t *testing.T) {
+	_, _, srv := newOAuthTestServer(t)
+	client := registerOAuthClient(t, srv, uuid.New(), false)
+	q := authorizeQuery(client, "chirps:read")
+	q.Del("redirect_uri")
+	code := authorize(t, srv, uuid.New(), q, true).Query().Get("code")
+
+	// Con un solo redirect_uri registrado se puede omitir en los dos pasos
+	var tokens oauthTokenResponse
+	res := postOAuthForm(t, srv, "/api/oauth/token", client, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {testCodeVerifier},
+	}, &tokens)
+	if res.StatusCode != http.StatusOK || tokens.AccessToken == "" {
+		t.Errorf("status = %d, tokens = %+v", res.StatusCode, tokens)
+	}
+}
+
+func TestOAuthReuseRevokesGrant(t *testing.T) {
+	t.Run("authorization code", func(t *testing.T) {
+		_, _, srv := newOAuthTestServer(t)
+		client := registerOAuthClient(t, srv, uuid.New(), false)
+		code := authorize(t, srv, uuid.New(), authorizeQuery(client, "chirps:read"), true).Query().Get("code")
+
+		tokens, res := exchangeCode(t, srv, client, code)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("first exchange: status %d", res.StatusCode)
+		}
+		if _, res := exchangeCode(t, srv, client, code); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("second exchange: status %d", res.StatusCode)
+		}
+		if status := getWithToken(t, srv, "/api/timeline", tokens.AccessToken); status != http.StatusUnauthorized {
+			t.Errorf("token from a reused code still works: status %d", status)
+		}
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		_, _, srv := newOAuthTestServer(t)
+		client := registerOAuthClient(t, srv, uuid.New(), false)
+		code := authorize(t, srv, uuid.New(), authorizeQuery(client, "chirps:read"), true).Query().Get("code")
+		tokens, _ := exchangeCode(t, srv, client, code)
+
+		refresh := func(token string) (oauthTokenResponse, int) {
+			var res oauthTokenResponse
+			r := postOAuthForm(t, srv, "/api/oauth/token", client, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}, &res)
+			return res, r.StatusCode
+		}
+		rotated, status := refresh(tokens.RefreshToken)
+		if status != http.StatusOK {
+			t.Fatalf("refresh: status %d", status)
+		}
+		if _, status := refresh(tokens.RefreshToken); status != http.StatusBadRequest {
+			t.Errorf("reused refresh token: status %d", status)
+		}
+		if _, status := refresh(rotated.RefreshToken); status != http.StatusBadRequest {
+			t.Errorf("refresh token after reuse: status %d", status)
+		}
+	})
+}
+
+func TestOAuthGrants(t *testing.T) {
+	_, _, srv := newOAuthTestServer(t)
+	user, other := uuid.New(), uuid.New()
+	client := registerOAuthClient(t, srv, uuid.New(), false)
+	code := authorize(t, srv, user, authorizeQuery(client, "chirps:read"), true).Query().Get("code")
+	tokens, _ := exchangeCode(t, srv, client, code)
+
+	listGrants := func(userID uuid.UUID) []oauthGrantResponse {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/oauth/grants", nil)
+		req.Header.Set("Authorization", bearer(t, userID))
+		var grants []oauthGrantResponse
+		if res := do(t, req, &grants); res.StatusCode != http.StatusOK {
+			t.Fatalf("list grants: status %d", res.StatusCode)
+		}
+		return grants
+	}
+	revokeGrant := func(userID uuid.UUID, grantID string) int {
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/oauth/grants/"+grantID, nil)
+		req.Header.Set("Authorization", bearer(t, userID))
+		return do(t, req, nil).StatusCode
+	}
+
+	grants := listGrants(user)
+	if len(grants) != 1 || grants[0].ClientID.String() != client.id || grants[0].ClientName != "Chirpy Desktop" || len(grants[0].Scopes) != 1 || grants[0].Scopes[0] != "chirps:read" {
+		t.Fatalf("grants = %+v", grants)
+	}
+	if got := listGrants(other); len(got) != 0 {
+		t.Errorf("other user sees grants %+v", got)
+	}
+	grantID := grants[0].ID.String()
+
+	// El grant de otro da 404 y sigue vivo
+	if status := revokeGrant(other, grantID); status != http.StatusNotFound {
+		t.Errorf("revoke other's grant: status %d", status)
+	}
+	if status := revokeGrant(user, "nope"); status != http.StatusBadRequest {
+		t.Errorf("revoke invalid id: status %d", status)
+	}
+	if status := getWithToken(t, srv, "/api/timeline", tokens.AccessToken); status != http.StatusOK {
+		t.Fatalf("timeline before revoke: status %d", status)
+	}
+
+	if status := revokeGrant(user, grantID); status != http.StatusNoContent {
+		t.Fatalf("revoke: status %d", status)
+	}
+	if status := getWithToken(t, srv, "/api/timeline", tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("access token after revoke: status %d", status)
+	}
+	if got := listGrants(user); len(got) != 0 {
+		t.Errorf("grants after revoke = %+v", got)
+	}
+	if status := revokeGrant(user, grantID); status != http.StatusNotFound {
+		t.Errorf("revoke twice: status %d", status)
+	}
+}
+
+// Lo que corta todas las sesiones tambien corta las apps, y una cuenta
+// suspendida no canjea codigos ni refresh tokens.
+func TestOAuthGrantsEndWithAccount(t *testing.T) {
+	refresh := func(t *testing.T, srv *httptest.Server, client oauthTestClient, token string) int {
+		return postOAuthForm(t, srv, "/api/oauth/token", client, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}, nil).StatusCode
+	}
+
+	t.Run("sign out everywhere", func(t *testing.T) {
+		_, _, srv := newOAuthTestServer(t)
+		user := uuid.New()
+		client := registerOAuthClient(t, srv, uuid.New(), false)
+		tokens, _ := exchangeCode(t, srv, client, authorize(t, srv, user, authorizeQuery(client, "chirps:read"), true).Query().Get("code"))
+		pending := authorize(t, srv, user, authorizeQuery(client, "chirps:read"), true).Query().Get("code")
+
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/sessions", nil)
+		req.Header.Set("Authorization", bearer(t, user))
+		if res := do(t, req, nil); res.StatusCode != http.StatusNoContent {
+			t.Fatalf("revoke all sessions: status %d", res.StatusCode)
+		}
+
+		if status := getWithToken(t, srv, "/api/timeline", tokens.AccessToken); status != http.StatusUnauthorized {
+			t.Errorf("access token: status %d", status)
+		}
+		if status := refresh(t, srv, client, tokens.RefreshToken); status != http.StatusBadRequest {
+			t.Errorf("refresh: status %d", status)
+		}
+		if _, res := exchangeCode(t, srv, client, pending); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("pending code: status %d", res.StatusCode)
+		}
+	})
+
+	t.Run("suspended", func(t *testing.T) {
+		_, store, srv := newOAuthTestServer(t)
+		user := uuid.New()
+		client := registerOAuthClient(t, srv, uuid.New(), false)
+		tokens, _ := exchangeCode(t, srv, client, authorize(t, srv, user, authorizeQuery(client, "chirps:read"), true).Query().Get("code"))
+		pending := authorize(t, srv, user, authorizeQuery(client, "chirps:read"), true).Query().Get("code")
+
+		store.suspend(user)
+
+		if status := getWithToken(t, srv, "/api/timeline", tokens.AccessToken); status != http.StatusUnauthorized {
+			t.Errorf("access token: status %d", status)
+		}
+		var oerr oauthError
+		if res := postOAuthForm(t, srv, "/api/oauth/token", client, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, &oerr); res.StatusCode != http.StatusBadRequest || oerr.Code != "invalid_grant" {
+			t.Errorf("refresh: status %d, error %+v", res.StatusCode, oerr)
+		}
+		if _, res := exchangeCode(t, srv, client, pending); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("pending code: status %d", res.StatusCode)
+		}
+	})
+}
+
+// browserGet hace un GET como el navegador: sin Authorization y sin seguir
+// el redirect.
+func browserGet(t *testing.T, rawURL string) *http.Response {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestOAuthAuthorizeBrowserHandoff(t *testing.T) {
+	_, store, srv := newOAuthTestServer(t)
+	user := uuid.New()
+	client := registerOAuthClient(t, srv, uuid.New(), false)
+	q := authorizeQuery(client, "chirps:read")
+
+	// 1. La app manda al navegador al authorization endpoint; sin sesion, se
+	// pasa el pedido tal cual a la pantalla del frontend
+	res := browserGet(t, srv.URL+"/oauth/authorize?"+q.Encode())
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("status = %d, want 302", res.StatusCode)
+	}
+	page, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Scheme+"://"+page.Host != "http://chirpy.test" || page.Path != "/app/oauth/authorize" || page.Query().Encode() != q.Encode() {
+		t.Fatalf("Location = %s", page)
+	}
+
+	// 2. Un POST que no trae el token del usuario (un form de otro sitio) no
+	// aprueba nada
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/oauth/authorize?"+page.RawQuery, strings.NewReader(`{"approve":true}`))
+	if res := do(t, req, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("POST without Authorization: status %d", res.StatusCode)
+	}
+	if len(store.codes) != 0 {
+		t.Fatalf("%d codes created without the user's token", len(store.codes))
+	}
+
+	// 3. La pantalla, con el token del usuario, muestra el pedido, aprueba y
+	// navega al redirect_to con el codigo que la app canjea
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/oauth/authorize?"+page.RawQuery, nil)
+	req.Header.Set("Authorization", bearer(t, user))
+	if res := do(t, req, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("consent info: status %d", res.StatusCode)
+	}
+	code := authorize(t, srv, user, page.Query(), true).Query().Get("code")
+	if _, res := exchangeCode(t, srv, client, code); res.StatusCode != http.StatusOK {
+		t.Errorf("exchange: status %d", res.StatusCode)
+	}
+}
+
+func TestOAuthAuthorizeBrowserErrors(t *testing.T) {
+	_, _, srv := newOAuthTestServer(t)
+	client := registerOAuthClient(t, srv, uuid.New(), false)
+
+	// Sin un redirect_uri valido el error se muestra y no se redirige
+	q := authorizeQuery(client, "chirps:read")
+	q.Set("redirect_uri", "https://evil.example.com/cb")
+	if res := browserGet(t, srv.URL+"/oauth/authorize?"+q.Encode()); res.StatusCode != http.StatusBadRequest || res.Header.Get("Location") != "" {
+		t.Errorf("unregistered redirect_uri: status %d, Location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	// Los demas errores vuelven a la app con el state
+	q = authorizeQuery(client, "admin")
+	res := browserGet(t, srv.URL+"/oauth/authorize?"+q.Encode())
+	back, _ := url.Parse(res.Header.Get("Location"))
+	if res.StatusCode != http.StatusFound || back.Host != "app.example.com" || back.Query().Get("error") != "invalid_scope" || back.Query().Get("state") != "xyz" {
+		t.Errorf("unknown scope: status %d, Location %s", res.StatusCode, back)
+	}
+}
+
+func TestHandlerOAuthAuthorizeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func(q url.Values)
+		deny       bool
+		want       string // error en el redirect; vacio si no hay redirect
+		wantStatus int
+	}{
+		{name: "unregistered redirect_uri", edit: func(q url.Values) { q.Set("redirect_uri", "https://evil.example.com/cb") }, wantStatus: http.StatusBadRequest},
+		{name: "unknown client", edit: func(q url.Values) { q.Set("client_id", uuid.NewString()) }, wantStatus: http.StatusBadRequest},
+		{name: "no PKCE", edit: func(q url.Values) { q.Del("code_challenge") }, want: "invalid_request"},
+		{name: "plain PKCE", edit: func(q url.Values) { q.Set("code_challenge_method", "plain") }, want: "invalid_request"},
+		{name: "unknown scope", edit: func(q url.Values) { q.Set("scope", "admin") }, want: "invalid_scope"},
+		{name: "token response type", edit: func(q url.Values) { q.Set("response_type", "token") }, want: "unsupported_response_type"},
+		{name: "user denies", edit: func(url.Values) {}, deny: true, want: "access_denied"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, store, srv := newOAuthTestServer(t)
+			client := registerOAuthClient(t, srv, uuid.New(), false)
+			q := authorizeQuery(client, "chirps:read")
+			tc.edit(q)
+
+			body := `{"approve":true}`
+			if tc.deny {
+				body = `{"approve":false}`
+			}
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/oauth/authorize?"+q.Encode(), strings.NewReader(body))
+			req.Header.Set("Authorization", bearer(t, uuid.New()))
+			var res authorizeRedirectResponse
+			r := do(t, req, &res)
+
+			if len(store.codes) != 0 {
+				t.Errorf("code created")
+			}
+			if tc.want == "" {
+				if r.StatusCode != tc.wantStatus || res.RedirectTo != "" {
+					t.Errorf("status = %d, redirect_to = %q", r.StatusCode, res.RedirectTo)
+				}
+				return
+			}
+			u, _ := url.Parse(res.RedirectTo)
+			if r.StatusCode != http.StatusOK || !strings.HasPrefix(res.RedirectTo, testRedirectURI) || u.Query().Get("error") != tc.want || u.Query().Get("state") != "xyz" {
+				t.Errorf("status = %d, redirect_to = %q, want error %q", r.StatusCode, res.RedirectTo, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequireRoleRejectsClientTokens(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	token, err := cfg.jwtKeys.MakeClientJWT(uuid.New(), uuid.New(), uuid.New(), []string{"chirps:read", "chirps:write", "profile:write"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/reports", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	cfg.requireRole(auth.RoleUser, func(http.ResponseWriter, *http.Request) {
+		t.Error("handler ran with a client token")
+	})(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d", rec.Code)
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := map[string]bool{
+		"https://app.example.com/callback": true,
+		"http://127.0.0.1:8123/cb":         true,
+		"http://localhost/cb":              true,
+		"http://[::1]:9000/cb":             true,
+		"com.example.app:/oauth":           true,
+		"http://app.example.com/cb":        false,
+		"https://app.example.com/cb#frag":  false,
+		"javascript:alert(1)":              false,
+		"/relative":                        false,
+		"https:///nohost":                  false,
+	}
+	for uri, want := range tests {
+		if got := validRedirectURI(uri); got != want {
+			t.Errorf("validRedirectURI(%q) = %v, want %v", uri, got, want)
+		}
+	}
+}
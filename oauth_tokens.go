@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 60 * 24 * time.Hour
+)
+
+var (
+	errOAuthTokenReused = errors.New("oauth refresh token reused")
+	errOAuthCodeReused  = errors.New("oauth authorization code reused")
+)
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// authenticateOAuthClient autentica al cliente que llama a los endpoints de
+// tokens (RFC 6749 2.3.1): con Basic o con client_id/client_secret en el form.
+// Los clientes publicos mandan solo client_id y no pueden mandar secret.
+func (cfg *apiConfig) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return database.OauthClient{}, false
+	}
+
+	clientIDStr, secret, basic := r.BasicAuth()
+	if !basic {
+		clientIDStr = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	fail := func() (database.OauthClient, bool) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "")
+		return database.OauthClient{}, false
+	}
+
+	clientID, err := uuid.Parse(clientIDStr)
+	if err != nil {
+		return fail()
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fail()
+		}
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return database.OauthClient{}, false
+	}
+
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return fail()
+		}
+		return client, true
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return fail()
+	}
+	return client, true
+}
+
+// POST /api/oauth/token: canjea un codigo de autorizacion o rota un refresh
+// token (RFC 6749 4.1.3 y 6).
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.oauthExchangeCode(w, r, client)
+	case "refresh_token":
+		cfg.oauthRefresh(w, r, client)
+	default:
+		respondOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func (cfg *apiConfig) oauthExchangeCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+	code, err := cfg.db.GetOAuthCode(r.Context(), codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+			return
+		}
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// Se valida todo antes de gastar el codigo: un verifier o un redirect_uri
+	// equivocados no lo queman y el cliente puede reintentar
+	if code.ClientID != client.ID {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		return
+	}
+	// Si el authorize trajo redirect_uri, el canje lo tiene que repetir; si
+	// el cliente lo omitio porque tiene uno solo, aca tambien lo puede omitir
+	redirectURI := r.PostForm.Get("redirect_uri")
+	if (code.RedirectUriSent || redirectURI != "") && redirectURI != code.RedirectUri {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+		return
+	}
+	if code.UsedAt.Valid {
+		cfg.revokeOAuthGrantOnCodeReuse(w, r, code.GrantID)
+		return
+	}
+	if time.Now().After(code.ExpiresAt) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		return
+	}
+	if !cfg.oauthUserActive(w, r, code.UserID) {
+		return
+	}
+
+	// El UPDATE ... WHERE used_at IS NULL es el que decide: de dos canjes
+	// validos a la vez gana uno y el otro cuenta como reuso
+	var resp oauthTokenResponse
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		consumed, err := q.ConsumeOAuthCode(r.Context(), codeHash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errOAuthCodeReused
+			}
+			return err
+		}
+		resp, err = cfg.issueOAuthTokens(r.Context(), q, consumed.GrantID, client.ID, consumed.UserID, consumed.Scopes, time.Now().UTC().Add(oauthRefreshTokenTTL))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errOAuthCodeReused) {
+			cfg.revokeOAuthGrantOnCodeReuse(w, r, code.GrantID)
+			return
+		}
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	respondOAuthTokens(w, resp)
+}
+
+// revokeOAuthGrantOnCodeReuse revoca lo que se emitio con el primer canje de
+// un codigo que se canjeo dos veces: se filtro (RFC 6749 4.1.2).
+func (cfg *apiConfig) revokeOAuthGrantOnCodeReuse(w http.ResponseWriter, r *http.Request, grantID uuid.UUID) {
+	if err := cfg.db.RevokeOAuthGrant(r.Context(), grantID); err != nil {
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	log.Printf("oauth authorization code reuse detected for grant %s", grantID)
+	respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+}
+
+func (cfg *apiConfig) oauthRefresh(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	tokenHash := auth.HashToken(r.PostForm.Get("refresh_token"))
+	row, err := cfg.db.GetOAuthToken(r.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if row.ClientID != client.ID {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+		return
+	}
+	if row.RevokedAt.Valid {
+		cfg.revokeOAuthGrantOnReuse(w, r, row.GrantID)
+		return
+	}
+	if time.Now().After(row.ExpiresAt) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token expired")
+		return
+	}
+	if !cfg.oauthUserActive(w, r, row.UserID) {
+		return
+	}
+
+	// Como en /api/refresh: se rota el token y el nuevo mantiene el
+	// vencimiento. Los scopes no se pueden cambiar en el refresh.
+	var resp oauthTokenResponse
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		claimed, err := q.ClaimOAuthToken(r.Context(), tokenHash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errOAuthTokenReused
+			}
+			return err
+		}
+		resp, err = cfg.issueOAuthTokens(r.Context(), q, claimed.GrantID, claimed.ClientID, claimed.UserID, claimed.Scopes, claimed.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errOAuthTokenReused) {
+			cfg.revokeOAuthGrantOnReuse(w, r, row.GrantID)
+			return
+		}
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	respondOAuthTokens(w, resp)
+}
+
+// oauthUserActive rechaza el canje si la cuenta que dio la autorizacion esta
+// suspendida o ya no existe.
+func (cfg *apiConfig) oauthUserActive(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	switch err := cfg.checkNotSuspended(r.Context(), userID); {
+	case err == nil:
+		return true
+	case errors.Is(err, errAccountSuspended), errors.Is(err, errUnauthenticated):
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "account not active")
+	default:
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+	}
+	return false
+}
+
+// revokeOAuthGrantOnReuse corta la autorizacion cuando un refresh token
+// rotado se vuelve a usar, igual que revokeRefreshFamily.
+func (cfg *apiConfig) revokeOAuthGrantOnReuse(w http.ResponseWriter, r *http.Request, grantID uuid.UUID) {
+	if err := cfg.db.RevokeOAuthGrant(r.Context(), grantID); err != nil {
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	log.Printf("oauth refresh token reuse detected for grant %s", grantID)
+	respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token revoked")
+}
+
+// issueOAuthTokens guarda un refresh token nuevo de la autorizacion y firma
+// el access token que lo acompana.
+func (cfg *apiConfig) issueOAuthTokens(ctx context.Context, q *database.Queries, grantID, clientID, userID uuid.UUID, scopes []string, refreshExpiresAt time.Time) (oauthTokenResponse, error) {
+	refreshToken, err := auth.MakePrefixedToken(auth.OAuthRefreshTokenPrefix)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	err = q.CreateOAuthToken(ctx, database.CreateOAuthTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		GrantID:   grantID,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: refreshExpiresAt,
+	})
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	accessToken, err := cfg.jwtKeys.MakeClientJWT(userID, clientID, grantID, scopes, oauthAccessTokenTTL)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	return oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+func respondOAuthTokens(w http.ResponseWriter, resp oauthTokenResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// oauthTokenInfo es lo que se sabe de un token de un cliente OAuth, sea
+// access token (JWT) o refresh token.
+type oauthTokenInfo struct {
+	grantID   uuid.UUID
+	clientID  uuid.UUID
+	userID    uuid.UUID
+	scopes    []string
+	tokenType string
+	active    bool
+	expiresAt time.Time
+	issuedAt  time.Time
+}
+
+// lookupOAuthToken busca un token de cliente; ok es false si no es uno.
+func (cfg *apiConfig) lookupOAuthToken(ctx context.Context, token string) (oauthTokenInfo, bool, error) {
+	if strings.HasPrefix(token, auth.OAuthRefreshTokenPrefix) {
+		row, err := cfg.db.GetOAuthToken(ctx, auth.HashToken(token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return oauthTokenInfo{}, false, nil
+			}
+			return oauthTokenInfo{}, false, err
+		}
+		return oauthTokenInfo{
+			grantID:   row.GrantID,
+			clientID:  row.ClientID,
+			userID:    row.UserID,
+			scopes:    row.Scopes,
+			tokenType: "refresh_token",
+			active:    !row.RevokedAt.Valid && time.Now().Before(row.ExpiresAt),
+			expiresAt: row.ExpiresAt,
+			issuedAt:  row.CreatedAt,
+		}, true, nil
+	}
+
+	// Los access tokens de login no son de ningun cliente
+	claims, err := cfg.jwtKeys.ParseJWT(token)
+	if err != nil || !claims.Delegated() {
+		return oauthTokenInfo{}, false, nil
+	}
+	grantID, err := uuid.Parse(claims.GrantID)
+	if err != nil {
+		return oauthTokenInfo{}, false, nil
+	}
+	clientID, err := uuid.Parse(claims.ClientID)
+	if err != nil {
+		return oauthTokenInfo{}, false, nil
+	}
+	active, err := cfg.db.IsOAuthGrantActive(ctx, grantID)
+	if err != nil {
+		return oauthTokenInfo{}, false, err
+	}
+	return oauthTokenInfo{
+		grantID:   grantID,
+		clientID:  clientID,
+		userID:    claims.UserID,
+		scopes:    claims.Scopes(),
+		tokenType: "Bearer",
+		active:    active,
+		expiresAt: claims.ExpiresAt.Time,
+		issuedAt:  claims.IssuedAt.Time,
+	}, true, nil
+}
+
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+}
+
+// POST /api/oauth/introspect (RFC 7662). Un cliente solo puede inspeccionar
+// sus propios tokens; los de otro dan inactivo, igual que uno desconocido.
+func (cfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	info, found, err := cfg.lookupOAuthToken(r.Context(), r.PostForm.Get("token"))
+	if err != nil {
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !found || !info.active || info.clientID != client.ID {
+		respondWithJSON(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, introspectionResponse{
+		Active:    true,
+		Scope:     strings.Join(info.scopes, " "),
+		ClientID:  info.clientID.String(),
+		Sub:       info.userID.String(),
+		TokenType: info.tokenType,
+		Exp:       info.expiresAt.Unix(),
+		Iat:       info.issuedAt.Unix(),
+	})
+}
+
+// POST /api/oauth/revoke (RFC 7009). Revocar cualquiera de los tokens corta
+// toda la autorizacion: el refresh token y los access tokens emitidos.
+// Responde 200 aunque el token no exista, asi no sirve para adivinarlos.
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	info, found, err := cfg.lookupOAuthToken(r.Context(), r.PostForm.Get("token"))
+	if err != nil {
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if found && info.clientID == client.ID {
+		if err := cfg.db.RevokeOAuthGrant(r.Context(), info.grantID); err != nil {
+			respondOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/oidc"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute
+	oidcCodeTTL     = time.Minute
+	oidcStateCookie = "chirpy_oidc_state"
+	oidcCookiePath  = "/api/login/oidc/"
+)
+
+var (
+	errOIDCEmailNotVerified = errors.New("identity provider did not verify the email")
+	errOIDCAccountExists    = errors.New("unverified account with the same email")
+)
+
+// loadOIDCProviders lee OIDC_PROVIDERS (nombres separados por coma) y, por
+// cada nombre, OIDC_<NOMBRE>_ISSUER, _CLIENT_ID y _CLIENT_SECRET. El callback
+// que hay que registrar en el proveedor es
+// <APP_BASE_URL>/api/login/oidc/<nombre>/callback.
+func loadOIDCProviders(appBaseURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  strings.TrimSuffix(appBaseURL, "/") + oidcCookiePath + name + "/callback",
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("oidc provider %q: %sISSUER, %sCLIENT_ID and %sCLIENT_SECRET are required", name, prefix, prefix, prefix)
+		}
+		providers[name] = oidc.NewProvider(cfg, nil)
+	}
+	return providers, nil
+}
+
+// oidcStateCookieFor es la cookie que ata el callback al navegador que empezo
+// el login: sin ella un atacante podria loguear a la victima con su cuenta.
+func (cfg *apiConfig) oidcStateCookieFor(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		// Lax: la vuelta del proveedor es una navegacion, la cookie viaja
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// GET /api/login/oidc/{provider}: manda al usuario a loguearse al proveedor
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[name]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	var state, nonce, verifier string
+	var err error
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		if *v, err = auth.MakeRefreshToken(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not start login")
+			return
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("oidc provider %s: %v", name, err)
+		respondWithError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	// Los logins abandonados se limpian aca; no hace falta un proceso aparte
+	if err := cfg.db.DeleteExpiredOIDCLogins(r.Context()); err != nil {
+		log.Printf("could not delete expired oidc logins: %v", err)
+	}
+	err = cfg.db.CreateOIDCLogin(r.Context(), database.CreateOIDCLoginParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not start login")
+		return
+	}
+
+	http.SetCookie(w, cfg.oidcStateCookieFor(state, int(oidcLoginTTL.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GET /api/login/oidc/{provider}/callback: la vuelta del proveedor. Valida el
+// ID token, busca (o crea y vincula) al usuario y redirige al frontend con un
+// codigo de un solo uso que se canjea en /api/login/oidc/exchange. Los tokens
+// no van en la URL: quedarian en el historial y en los logs.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[name]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	// El state es de un solo uso: la cookie se borra pase lo que pase
+	http.SetCookie(w, cfg.oidcStateCookieFor("", -1))
+
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		respondWithError(w, http.StatusUnauthorized, "login cancelled at identity provider")
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "invalid state")
+		return
+	}
+	login, err := cfg.db.ConsumeOIDCLogin(r.Context(), auth.HashToken(state))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "invalid state")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not complete login")
+		return
+	}
+	if login.Provider != name {
+		respondWithError(w, http.StatusBadRequest, "invalid state")
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), q.Get("code"), login.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc provider %s: %v", name, err)
+		respondWithError(w, http.StatusBadGateway, "could not complete login with identity provider")
+		return
+	}
+	idToken, err := provider.VerifyIDToken(r.Context(), rawIDToken, login.Nonce)
+	if err != nil {
+		log.Printf("oidc provider %s: %v", name, err)
+		respondWithError(w, http.StatusUnauthorized, "invalid ID token")
+		return
+	}
+
+	dbUser, err := cfg.userForIdentity(r.Context(), idToken)
+	switch {
+	case errors.Is(err, errOIDCEmailNotVerified):
+		respondWithError(w, http.StatusForbidden, "the identity provider has not verified your email")
+		return
+	case errors.Is(err, errOIDCAccountExists):
+		respondWithError(w, http.StatusConflict, "an account with this email already exists; verify it before signing in with a provider")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "could not complete login")
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not complete login")
+		return
+	}
+	err = cfg.db.CreateOIDCLoginCode(r.Context(), database.CreateOIDCLoginCodeParams{
+		CodeHash:  auth.HashToken(code),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().UTC().Add(oidcCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not complete login")
+		return
+	}
+
+	link := strings.TrimRight(cfg.appBaseURL, "/") + "/app/login/oidc?code=" + url.QueryEscape(code)
+	http.Redirect(w, r, link, http.StatusFound)
+}
+
+type oidcExchangeRequest struct {
+	Code string `json:"code"`
+}
+
+// POST /api/login/oidc/exchange: el frontend canjea el codigo del callback y
+// sigue como /api/login (suspension, 2FA y tokens).
+func (cfg *apiConfig) handlerOIDCExchange(w http.ResponseWriter, r *http.Request) {
+	var req oidcExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "code required")
+		return
+	}
+
+	dbUser, err := cfg.db.ConsumeOIDCLoginCode(r.Context(), auth.HashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "invalid or expired code")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not complete login")
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser)
+}
+
+// userForIdentity busca al usuario vinculado a (issuer, subject). La primera
+// vez lo vincula a la cuenta con el mismo email, si ambos lados lo
+// verificaron, o crea una cuenta nueva.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, tok *oidc.IDToken) (database.User, error) {
+	dbUser, err := cfg.db.LoginUserIdentity(ctx, database.LoginUserIdentityParams{
+		Issuer:  tok.Issuer,
+		Subject: tok.Subject,
+		Email:   tok.Email,
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		return dbUser, err
+	}
+
+	if tok.Email == "" || !tok.EmailVerified {
+		return database.User{}, errOIDCEmailNotVerified
+	}
+
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		existing, err := q.GetUserEmail(ctx, tok.Email)
+		switch {
+		case err == nil:
+			// Una cuenta sin verificar puede ser de alguien que registro un
+			// email ajeno: vincularla le daria el login del dueno real
+			if !existing.VerifiedAt.Valid {
+				return errOIDCAccountExists
+			}
+			dbUser = existing
+		case errors.Is(err, sql.ErrNoRows):
+			// Cuenta nueva sin password usable: se entra por el proveedor o
+			// pidiendo un reset de password
+			password, err := auth.MakeRefreshToken()
+			if err != nil {
+				return err
+			}
+			hash, err := auth.HashPassword(password)
+			if err != nil {
+				return err
+			}
+			dbUser, err = q.CreateUser(ctx, database.CreateUserParams{
+				Email:          tok.Email,
+				HashedPassword: hash,
+			})
+			if err != nil {
+				return err
+			}
+			if err := q.MarkUserEmailVerified(ctx, dbUser.ID); err != nil {
+				return err
+			}
+			dbUser.VerifiedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		default:
+			return err
+		}
+
+		return q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			UserID:  dbUser.ID,
+			Issuer:  tok.Issuer,
+			Subject: tok.Subject,
+			Email:   tok.Email,
+		})
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return dbUser, nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/oidc"
+	"github.com/bootdotdev/learn-http-servers/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// fakeOIDCStore tiene los usuarios, las identidades vinculadas y los logins
+// en curso del flujo contra el IdP de prueba.
+type fakeOIDCStore struct {
+	mu         sync.Mutex
+	users      map[string]database.User // por email
+	identities map[string]uuid.UUID     // issuer + " " + subject
+	logins     map[string][]driver.Value
+	codes      map[string]uuid.UUID // hash del codigo de login -> usuario
+}
+
+func newFakeOIDCStore(f *fakeDB) *fakeOIDCStore {
+	s := &fakeOIDCStore{
+		users:      map[string]database.User{},
+		identities: map[string]uuid.UUID{},
+		logins:     map[string][]driver.Value{},
+		codes:      map[string]uuid.UUID{},
+	}
+	userByID := func(id uuid.UUID) (database.User, bool) {
+		for _, u := range s.users {
+			if u.ID == id {
+				return u, true
+			}
+		}
+		return database.User{}, false
+	}
+
+	f.returns("DeleteExpiredOIDCLogins")
+	f.returns("GetUserTOTP")
+	f.on("CreateOIDCLogin", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.logins[args[0].(string)] = []driver.Value{args[0], args[1], args[2], args[3], time.Now(), args[4]}
+		return nil, nil
+	})
+	f.on("ConsumeOIDCLogin", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		row, ok := s.logins[args[0].(string)]
+		if !ok {
+			return nil, nil
+		}
+		delete(s.logins, args[0].(string))
+		return [][]driver.Value{row}, nil
+	})
+	f.on("LoginUserIdentity", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		id, ok := s.identities[args[0].(string)+" "+args[1].(string)]
+		if !ok {
+			return nil, nil
+		}
+		u, _ := userByID(id)
+		return [][]driver.Value{userRow(u)}, nil
+	})
+	f.on("GetUserEmail", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if u, ok := s.users[args[0].(string)]; ok {
+			return [][]driver.Value{userRow(u)}, nil
+		}
+		return nil, nil
+	})
+	f.on("CreateUser", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		u := database.User{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Email: args[0].(string), HashedPassword: args[1].(string)}
+		s.users[u.Email] = u
+		return [][]driver.Value{userRow(u)}, nil
+	})
+	f.on("MarkUserEmailVerified", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		u, _ := userByID(uuid.MustParse(args[0].(string)))
+		u.VerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		s.users[u.Email] = u
+		return nil, nil
+	})
+	f.on("CreateUserIdentity", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.identities[args[1].(string)+" "+args[2].(string)] = uuid.MustParse(args[0].(string))
+		return nil, nil
+	})
+	f.on("CreateOIDCLoginCode", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.codes[args[0].(string)] = uuid.MustParse(args[1].(string))
+		return nil, nil
+	})
+	f.on("ConsumeOIDCLoginCode", func(args []driver.Value) ([][]driver.Value, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		id, ok := s.codes[args[0].(string)]
+		if !ok {
+			return nil, nil
+		}
+		delete(s.codes, args[0].(string))
+		u, _ := userByID(id)
+		return [][]driver.Value{userRow(u)}, nil
+	})
+	f.on("CreateToken", func(args []driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{refreshTokenRow(database.RefreshToken{
+			TokenHash: args[0].(string),
+			UserID:    uuid.MustParse(args[1].(string)),
+			ExpiresAt: args[2].(time.Time),
+			FamilyID:  uuid.New(),
+		})}, nil
+	})
+	return s
+}
+
+// oidcTestAppURL es el frontend al que vuelve el callback; no existe, los
+// tests cortan el redirect ahi.
+const oidcTestAppURL = "https://chirpy.test"
+
+// newOIDCTestServer levanta Chirpy con el proveedor "test" apuntando a un IdP
+// local.
+func newOIDCTestServer(t *testing.T) (*oidctest.IdP, *fakeOIDCStore, *fakeDB, *httptest.Server) {
+	t.Helper()
+	cfg, f := newTestConfig(t)
+	store := newFakeOIDCStore(f)
+	idp := oidctest.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/login/oidc/{provider}", cfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", cfg.handlerOIDCCallback)
+	mux.HandleFunc("POST /api/login/oidc/exchange", cfg.handlerOIDCExchange)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	cfg.appBaseURL = oidcTestAppURL
+
+	cfg.oidcProviders = map[string]*oidc.Provider{
+		"test": oidc.NewProvider(oidc.Config{
+			Issuer:       idp.Issuer,
+			ClientID:     oidctest.ClientID,
+			ClientSecret: oidctest.ClientSecret,
+			RedirectURL:  srv.URL + "/api/login/oidc/test/callback",
+		}, nil),
+	}
+	return idp, store, f, srv
+}
+
+// oidcLogin hace el login completo como un navegador: sigue los redirects
+// (Chirpy -> IdP -> callback) con las cookies hasta el frontend y, como el
+// frontend, canjea el codigo. Si el callback falla devuelve esa respuesta.
+func oidcLogin(t *testing.T, srv *httptest.Server) (*http.Response, User) {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar, CheckRedirect: stopAtFrontend}
+	res, err := client.Get(srv.URL + "/api/login/oidc/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return res, User{}
+	}
+
+	landing, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exchangeOIDCCode(t, srv, landing.Query().Get("code"))
+}
+
+// stopAtFrontend sigue los redirects hasta que el callback vuelve al frontend.
+func stopAtFrontend(req *http.Request, _ []*http.Request) error {
+	if strings.HasPrefix(req.URL.String(), oidcTestAppURL+"/") {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+func exchangeOIDCCode(t *testing.T, srv *httptest.Server, code string) (*http.Response, User) {
+	t.Helper()
+	res, err := http.Post(srv.URL+"/api/login/oidc/exchange", "application/json", strings.NewReader(`{"code":"`+code+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var user User
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(&user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res, user
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idpUser := oidctest.User{Subject: "10769150350006150715113082367", Email: "jane@example.com", EmailVerified: true}
+	verified := sql.NullTime{Time: time.Now(), Valid: true}
+
+	tests := []struct {
+		name       string
+		idpUser    oidctest.User
+		existing   *database.User
+		tamper     func(jwt.MapClaims)
+		wantStatus int
+		wantLinked bool
+	}{
+		{name: "creates a verified account", idpUser: idpUser, wantStatus: http.StatusOK, wantLinked: true},
+		{name: "links the verified account with the same email", idpUser: idpUser, existing: &database.User{Email: idpUser.Email, VerifiedAt: verified}, wantStatus: http.StatusOK, wantLinked: true},
+		{name: "does not link an unverified account", idpUser: idpUser, existing: &database.User{Email: idpUser.Email}, wantStatus: http.StatusConflict},
+		{name: "email not verified by the provider", idpUser: oidctest.User{Subject: "1", Email: "jane@example.com"}, wantStatus: http.StatusForbidden},
+		{name: "suspended account", idpUser: idpUser, existing: &database.User{Email: idpUser.Email, VerifiedAt: verified, SuspendedAt: verified}, wantStatus: http.StatusForbidden, wantLinked: true},
+		{name: "id token for another client", idpUser: idpUser, tamper: func(c jwt.MapClaims) { c["aud"] = "other-client" }, wantStatus: http.StatusUnauthorized},
+		{name: "id token with another nonce", idpUser: idpUser, tamper: func(c jwt.MapClaims) { c["nonce"] = "replayed" }, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			idp, store, f, srv := newOIDCTestServer(t)
+			idp.SetUser(tc.idpUser)
+			if tc.tamper != nil {
+				idp.Tamper(tc.tamper)
+			}
+			if tc.existing != nil {
+				tc.existing.ID = uuid.New()
+				store.users[tc.existing.Email] = *tc.existing
+			}
+
+			res, user := oidcLogin(t, srv)
+			if res.StatusCode != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tc.wantStatus)
+			}
+
+			linked, ok := store.identities[idp.Issuer+" "+tc.idpUser.Subject]
+			if ok != tc.wantLinked {
+				t.Fatalf("identity linked = %v, want %v", ok, tc.wantLinked)
+			}
+			if tc.existing != nil && ok && linked != tc.existing.ID {
+				t.Errorf("identity linked to %s, want %s", linked, tc.existing.ID)
+			}
+			if created := len(f.called("CreateUser")) > 0; created != (tc.existing == nil && tc.wantLinked) {
+				t.Errorf("CreateUser called = %v", created)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			if user.Token == "" || user.RefreshToken == "" || user.Email != tc.idpUser.Email || !user.IsVerified {
+				t.Errorf("user = %+v", user)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginReturningUser(t *testing.T) {
+	idp, store, f, srv := newOIDCTestServer(t)
+	idp.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true})
+
+	_, first := oidcLogin(t, srv)
+	// El email cambia en el proveedor: la cuenta se sigue encontrando por
+	// (issuer, subject)
+	idp.SetUser(oidctest.User{Subject: "42", Email: "jane@new.example.com", EmailVerified: true})
+	res, second := oidcLogin(t, srv)
+
+	if res.StatusCode != http.StatusOK || second.ID != first.ID {
+		t.Fatalf("status = %d, user %s then %s", res.StatusCode, first.ID, second.ID)
+	}
+	if n := len(f.called("CreateUser")); n != 1 {
+		t.Errorf("CreateUser called %d times", n)
+	}
+	if args := f.called("LoginUserIdentity")[1]; args[2] != "jane@new.example.com" {
+		t.Errorf("LoginUserIdentity args = %v", args)
+	}
+	if len(store.identities) != 1 {
+		t.Errorf("identities = %v", store.identities)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	idp, _, _, srv := newOIDCTestServer(t)
+	idp.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true})
+	noRedirects := func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	// startLogin va hasta el IdP y devuelve el callback, sin seguirlo
+	startLogin := func(client *http.Client) *url.URL {
+		t.Helper()
+		res, err := client.Get(srv.URL + "/api/login/oidc/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		res, err = client.Get(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		callback, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return callback
+	}
+
+	jar, _ := cookiejar.New(nil)
+	victim := &http.Client{Jar: jar, CheckRedirect: noRedirects}
+	callback := startLogin(victim)
+
+	// Sin la cookie del navegador que empezo el login (login CSRF)
+	res, err := (&http.Client{CheckRedirect: noRedirects}).Get(callback.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback without cookie: status %d", res.StatusCode)
+	}
+
+	// Con otro state que el de la cookie
+	jar, _ = cookiejar.New(nil)
+	other := &http.Client{Jar: jar, CheckRedirect: noRedirects}
+	startLogin(other)
+	res, _ = other.Get(callback.String())
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback with another state: status %d", res.StatusCode)
+	}
+
+	// El navegador correcto entra, una sola vez
+	res, _ = victim.Get(callback.String())
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound || !strings.HasPrefix(res.Header.Get("Location"), oidcTestAppURL+"/app/login/oidc?code=") {
+		t.Fatalf("callback: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	jar.SetCookies(callback, []*http.Cookie{{Name: oidcStateCookie, Value: callback.Query().Get("state"), Path: oidcCookiePath}})
+	res, _ = other.Get(callback.String())
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("state reused: status %d", res.StatusCode)
+	}
+}
+
+// El callback no pone tokens en la URL: manda un codigo que sirve una vez.
+func TestOIDCLoginCode(t *testing.T) {
+	idp, store, _, srv := newOIDCTestServer(t)
+	idp.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true})
+	client := &http.Client{CheckRedirect: stopAtFrontend}
+	client.Jar, _ = cookiejar.New(nil)
+
+	res, err := client.Get(srv.URL + "/api/login/oidc/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	landing, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Fatalf("callback: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if got := landing.Query(); len(got) != 1 || got.Get("code") == "" {
+		t.Fatalf("frontend gets %v, want only a code", got)
+	}
+	code := landing.Query().Get("code")
+	if _, ok := store.codes[code]; ok {
+		t.Error("code stored in plain text")
+	}
+
+	if res, _ := exchangeOIDCCode(t, srv, "not-a-code"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unknown code: status %d", res.StatusCode)
+	}
+	res, user := exchangeOIDCCode(t, srv, code)
+	if res.StatusCode != http.StatusOK || user.Token == "" || user.Email != "jane@example.com" {
+		t.Fatalf("exchange: status %d, user %+v", res.StatusCode, user)
+	}
+	if res, _ := exchangeOIDCCode(t, srv, code); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("code reused: status %d", res.StatusCode)
+	}
+}
+
+func TestHandlerOIDCLoginUnknownProvider(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/login/oidc/nope", nil)
+	req.SetPathValue("provider", "nope")
+	rec := httptest.NewRecorder()
+	cfg.handlerOIDCLogin(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d", rec.Code)
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "google")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "id")
+	if _, err := loadOIDCProviders("http://chirpy.test"); err == nil {
+		t.Error("provider without client secret loaded")
+	}
+
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "secret")
+	providers, err := loadOIDCProviders("http://chirpy.test")
+	if err != nil || providers["google"] == nil || providers["google"].Issuer() != "https://accounts.google.com" {
+		t.Errorf("providers = %v, %v", providers, err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor marca la posicion del ultimo chirp devuelto. Se manda al cliente
+// como un string opaco (JSON en base64url) para poder cambiarlo sin romper nada.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	// Solo para la busqueda, que ordena primero por relevancia
+	Rank *float32 `json:"r,omitempty"`
+}
+
+type pageParams struct {
+	Cursor *pageCursor
+	Limit  int32
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil || c.CreatedAt.IsZero() {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// parsePageParams lee ?cursor= y ?limit= de la query. El limit se recorta a
+// maxPageLimit; valores no numericos o menores a 1 son un error.
+func parsePageParams(r *http.Request) (pageParams, error) {
+	params := pageParams{Limit: defaultPageLimit}
+
+	limit, err := parseLimit(r, defaultPageLimit, maxPageLimit)
+	if err != nil {
+		return params, err
+	}
+	params.Limit = int32(limit)
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := decodeCursor(raw)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = &c
+	}
+
+	return params, nil
+}
+
+// parseLimit lee ?limit= de la query: def si no viene, recortado a max.
+func parseLimit(r *http.Request, def, max int) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return min(n, max), nil
+}
+
+// newChirpsPage arma la respuesta a partir de hasta limit+1 filas: si vino la
+// fila extra hay otra pagina y el cursor apunta al ultimo chirp devuelto.
+func (cfg *apiConfig) newChirpsPage(ctx context.Context, dbChirps []database.Chirp, limit int32, viewer uuid.NullUUID) (chirpsPageResponse, error) {
+	var res chirpsPageResponse
+	if len(dbChirps) > int(limit) {
+		dbChirps = dbChirps[:limit]
+		last := dbChirps[len(dbChirps)-1]
+		res.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	chirps, err := cfg.chirpResponses(ctx, dbChirps, viewer)
+	if err != nil {
+		return res, err
+	}
+	res.Chirps = chirps
+	return res, nil
+}
+
+// setNextPageLink manda el cursor de la pagina siguiente en un header Link
+// (RFC 8288) con la misma query que el request. Sin cursor no hay header.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	if cursor == "" {
+		return
+	}
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+}
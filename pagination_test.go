@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	in := pageCursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), ID: uuid.New()}
+
+	out, err := decodeCursor(encodeCursor(in))
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !out.CreatedAt.Equal(in.CreatedAt) || out.ID != in.ID {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+
+	for _, bad := range []string{"%%%", "bm90IGpzb24", encodeCursor(pageCursor{})} {
+		if _, err := decodeCursor(bad); err == nil {
+			t.Errorf("decodeCursor(%q) expected error", bad)
+		}
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantLimit int32
+		wantErr   bool
+	}{
+		{query: "", wantLimit: defaultPageLimit},
+		{query: "limit=10", wantLimit: 10},
+		{query: "limit=100000", wantLimit: maxPageLimit},
+		{query: "limit=0", wantErr: true},
+		{query: "limit=abc", wantErr: true},
+		{query: "cursor=garbage", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/chirps?"+tc.query, nil)
+			p, err := parsePageParams(r)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p.Limit != tc.wantLimit {
+				t.Errorf("limit = %d, want %d", p.Limit, tc.wantLimit)
+			}
+		})
+	}
+}
+
+func TestHandlerGetChirpsPaginates(t *testing.T) {
+	cfg, f := newTestConfig(t)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rows [][]driver.Value
+	var chirps []database.Chirp
+	for i := 0; i < 3; i++ {
+		c := database.Chirp{ID: uuid.New(), CreatedAt: base.Add(time.Duration(i) * time.Minute), Body: "c", UserID: uuid.New()}
+		chirps = append(chirps, c)
+		rows = append(rows, chirpRow(c))
+	}
+	f.returns("GetChirps", rows...)
+	f.returns("GetChirpStats")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps?limit=2", nil)
+	rec := httptest.NewRecorder()
+	cfg.handlerGetChirps(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	// El body es el array de siempre: los clientes viejos no se rompen
+	var res []chirpResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("got %d chirps, want 2", len(res))
+	}
+
+	// Se piden limit+1 filas para detectar la siguiente pagina
+	if got := f.called("GetChirps")[0][4]; got != int64(3) {
+		t.Errorf("page_limit arg = %v, want 3", got)
+	}
+
+	link := rec.Header().Get("Link")
+	if !strings.HasPrefix(link, "</api/chirps?") || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("Link = %q", link)
+	}
+	nextURL, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nextURL.Query().Get("limit"); got != "2" {
+		t.Errorf("next page limit = %q, want 2", got)
+	}
+	next, err := decodeCursor(nextURL.Query().Get("cursor"))
+	if err != nil {
+		t.Fatalf("next cursor: %v", err)
+	}
+	if next.ID != chirps[1].ID || !next.CreatedAt.Equal(chirps[1].CreatedAt) {
+		t.Errorf("next cursor = %+v, want last chirp of the page", next)
+	}
+}
+
+func TestHandlerGetChirpsFilters(t *testing.T) {
+	authorID := uuid.New()
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantAuthor driver.Value
+		wantDesc   driver.Value
+	}{
+		{query: "", wantStatus: http.StatusOK, wantAuthor: nil, wantDesc: false},
+		{query: "sort=desc", wantStatus: http.StatusOK, wantAuthor: nil, wantDesc: true},
+		{query: "author_id=" + authorID.String() + "&sort=asc", wantStatus: http.StatusOK, wantAuthor: authorID.String(), wantDesc: false},
+		{query: "author_id=nope", wantStatus: http.StatusBadRequest},
+		{query: "sort=sideways", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("GetChirps")
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps?"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerGetChirps(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			// Sin mas paginas: array vacio y sin Link
+			if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+				t.Errorf("body = %s, want []", body)
+			}
+			if link := rec.Header().Get("Link"); link != "" {
+				t.Errorf("Link = %q on the last page", link)
+			}
+			args := f.called("GetChirps")[0]
+			if args[0] != tc.wantAuthor {
+				t.Errorf("author_id arg = %v, want %v", args[0], tc.wantAuthor)
+			}
+			if args[2] != tc.wantDesc {
+				t.Errorf("descending arg = %v, want %v", args[2], tc.wantDesc)
+			}
+		})
+	}
+}
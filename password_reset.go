@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/mailer"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	// El mail se manda despues de responder; esto corta un SMTP colgado
+	passwordResetSendTimeout = 30 * time.Second
+	// Pedidos en espera y workers que mandan los mails. Con la cola llena el
+	// pedido se descarta: el usuario puede volver a pedirlo
+	passwordResetQueueSize = 100
+	passwordResetWorkers   = 2
+)
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// POST /api/password-reset/request: siempre 202, exista o no el email, para
+// no revelar que cuentas hay.
+func (cfg *apiConfig) handlerPasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	// Se responde antes de buscar al usuario y mandar el mail: si no, los
+	// emails registrados tardarian mas en contestar y se podrian enumerar
+	select {
+	case cfg.passwordResets <- strings.TrimSpace(req.Email):
+	default:
+		log.Printf("password reset queue full, dropping request")
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startPasswordResets arma la cola de los mails de reset y arranca los
+// workers que los mandan. La funcion que devuelve cierra la cola y espera a
+// que salgan los pendientes; se llama despues de que el server dejo de
+// atender requests.
+func (cfg *apiConfig) startPasswordResets(workers, size int) (stop func()) {
+	queue := make(chan string, size)
+	cfg.passwordResets = queue
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for email := range queue {
+				ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+				if err := cfg.sendPasswordReset(ctx, email); err != nil {
+					log.Printf("could not send password reset: %v", err)
+				}
+				cancel()
+			}
+		}()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(queue)
+			wg.Wait()
+		})
+	}
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	if !validEmail(email) {
+		return nil
+	}
+	dbUser, err := cfg.db.GetUserEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	if err := cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(cfg.appBaseURL, "/") + "/app/reset-password?token=" + url.QueryEscape(token)
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\nOpen this link within %s to choose a new one:\n\n%s\n\nOr use this code: %s\n\nIf it wasn't you, ignore this email.\n",
+			passwordResetTTL, link, token),
+	})
+}
+
+// POST /api/password-reset/confirm: cambia la password con el token del mail.
+// Cierra todas las sesiones del usuario y revoca sus API keys y apps.
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" || strings.TrimSpace(req.Password) == "" {
+		respondWithError(w, http.StatusBadRequest, "token and password required")
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not hash password")
+		return
+	}
+
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		userID, err := q.ConsumePasswordResetToken(r.Context(), auth.HashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		if err := q.SetUserPassword(r.Context(), database.SetUserPasswordParams{ID: userID, HashedPassword: hash}); err != nil {
+			return err
+		}
+		// Los otros links pendientes, los refresh tokens, las API keys y las
+		// apps autorizadas dejan de servir: quien tenga algo filtrado pierde
+		// el acceso
+		if err := q.InvalidatePasswordResetTokens(r.Context(), userID); err != nil {
+			return err
+		}
+		if err := q.RevokeUserAPIKeys(r.Context(), userID); err != nil {
+			return err
+		}
+		if err := q.RevokeUserOAuthGrants(r.Context(), userID); err != nil {
+			return err
+		}
+		return q.RevokeUserTokens(r.Context(), userID)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/mailer"
+	"github.com/google/uuid"
+)
+
+func TestHandlerPasswordResetRequest(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "a@example.com"}
+
+	tests := []struct {
+		name      string
+		email     string
+		setup     func(f *fakeDB)
+		wantMails int
+	}{
+		{
+			name:  "known email",
+			email: "a@example.com",
+			setup: func(f *fakeDB) {
+				f.returns("GetUserEmail", userRow(user))
+				f.returns("CreatePasswordResetToken")
+			},
+			wantMails: 1,
+		},
+		{name: "unknown email", email: "nobody@example.com", setup: func(f *fakeDB) { f.returns("GetUserEmail") }},
+		{name: "not an email", email: "nope"},
+		{
+			name:  "db error",
+			email: "a@example.com",
+			setup: func(f *fakeDB) {
+				f.on("GetUserEmail", func([]driver.Value) ([][]driver.Value, error) { return nil, errors.New("boom") })
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+			stop := cfg.startPasswordResets(1, 1)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/password-reset/request", strings.NewReader(`{"email":"`+tc.email+`"}`))
+			rec := httptest.NewRecorder()
+			cfg.handlerPasswordResetRequest(rec, req)
+
+			// Siempre lo mismo, para no revelar que emails existen
+			if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+				t.Fatalf("status = %d (%s), want an empty 202", rec.Code, rec.Body.String())
+			}
+			// El mail sale despues de responder; stop espera a la cola
+			stop()
+			sent := cfg.mailer.(*fakeMailer).messages()
+			if len(sent) != tc.wantMails {
+				t.Fatalf("sent %d mails, want %d", len(sent), tc.wantMails)
+			}
+			if tc.wantMails == 0 {
+				return
+			}
+			token := mailedToken(t, sent[0].Body)
+			args := f.called("CreatePasswordResetToken")[0]
+			if args[0] != auth.HashToken(token) || args[1] != user.ID.String() {
+				t.Errorf("CreatePasswordResetToken args = %v", args)
+			}
+			if !strings.Contains(sent[0].Body, "http://chirpy.test/app/reset-password?token="+token) {
+				t.Errorf("mail without link: %q", sent[0].Body)
+			}
+		})
+	}
+}
+
+// blockingMailer avisa en started cuando empieza a mandar y no termina hasta
+// que se cierre release.
+type blockingMailer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(ctx context.Context, _ mailer.Message) error {
+	m.started <- struct{}{}
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Un SMTP lento no puede demorar la respuesta: delataria que el email existe.
+// Con la cola llena el pedido se descarta, tambien sin esperar.
+func TestHandlerPasswordResetRequestDoesNotWaitForMail(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	f.returns("GetUserEmail", userRow(database.User{ID: uuid.New(), Email: "a@example.com"}))
+	f.returns("CreatePasswordResetToken")
+	mail := blockingMailer{started: make(chan struct{}, 3), release: make(chan struct{})}
+	cfg.mailer = mail
+	stop := cfg.startPasswordResets(1, 1)
+
+	request := func() {
+		t.Helper()
+		done := make(chan int)
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/password-reset/request", strings.NewReader(`{"email":"a@example.com"}`))
+			rec := httptest.NewRecorder()
+			cfg.handlerPasswordResetRequest(rec, req)
+			done <- rec.Code
+		}()
+		select {
+		case code := <-done:
+			if code != http.StatusAccepted {
+				t.Errorf("status = %d, want 202", code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("handler waited for the mail to be sent")
+		}
+	}
+
+	request()
+	<-mail.started // el worker quedo colgado con el primero
+	request()      // a la cola
+	request()      // cola llena: se descarta
+
+	// Al apagar se manda lo que quedo en la cola
+	close(mail.release)
+	stop()
+	if n := len(f.called("GetUserEmail")); n != 2 {
+		t.Errorf("processed %d requests, want 2", n)
+	}
+}
+
+func TestHandlerPasswordResetConfirm(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		valid      bool
+		wantStatus int
+	}{
+		{name: "resets", body: `{"token":"abc","password":"new-pw"}`, valid: true, wantStatus: http.StatusNoContent},
+		{name: "used or expired", body: `{"token":"abc","password":"new-pw"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing password", body: `{"token":"abc"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.valid {
+				f.returns("ConsumePasswordResetToken", []driver.Value{userID.String()})
+			} else {
+				f.returns("ConsumePasswordResetToken")
+			}
+			f.returns("SetUserPassword")
+			f.returns("InvalidatePasswordResetTokens")
+			f.returns("RevokeUserAPIKeys")
+			f.returns("RevokeUserOAuthGrants")
+			f.returns("RevokeUserTokens")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/password-reset/confirm", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			cfg.handlerPasswordResetConfirm(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if !tc.valid {
+				if len(f.called("SetUserPassword")) != 0 || len(f.called("RevokeUserTokens")) != 0 {
+					t.Error("nothing should change without a valid token")
+				}
+				return
+			}
+
+			if args := f.called("ConsumePasswordResetToken")[0]; args[0] != auth.HashToken("abc") {
+				t.Errorf("ConsumePasswordResetToken arg = %v, want the token hash", args[0])
+			}
+			args := f.called("SetUserPassword")[0]
+			if args[0] != userID.String() || auth.CheckPasswordHash("new-pw", args[1].(string)) != nil {
+				t.Errorf("SetUserPassword args = %v", args)
+			}
+			for _, q := range []string{"InvalidatePasswordResetTokens", "RevokeUserAPIKeys", "RevokeUserOAuthGrants", "RevokeUserTokens"} {
+				if calls := f.called(q); len(calls) != 1 || calls[0][0] != userID.String() {
+					t.Errorf("%s calls = %v", q, calls)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/ratelimit"
+)
+
+// Limites por ruta: las escrituras y el login van mas ajustados que las
+// lecturas. RATE_LIMITS pisa estas entradas de a una.
+var defaultRouteRateLimits = map[string]ratelimit.Limit{
+	"POST /api/chirps":                        ratelimit.PerPeriod(10, time.Minute),
+	"POST /api/login":                         ratelimit.PerPeriod(10, time.Minute),
+	"POST /api/login/2fa":                     ratelimit.PerPeriod(10, time.Minute),
+	"GET /api/login/oidc/{provider}/callback": ratelimit.PerPeriod(10, time.Minute),
+	"POST /api/users":                         ratelimit.PerPeriod(5, time.Minute),
+	"POST /api/password-reset/request":        ratelimit.PerPeriod(5, time.Minute),
+	"POST /api/oauth/token":                   ratelimit.PerPeriod(20, time.Minute),
+	"GET /api/chirps":                         ratelimit.PerPeriod(120, time.Minute),
+	"GET /api/chirps/{chirpID}":               ratelimit.PerPeriod(120, time.Minute),
+	"GET /api/chirps/search":                  ratelimit.PerPeriod(60, time.Minute),
+	"GET /api/timeline":                       ratelimit.PerPeriod(120, time.Minute),
+}
+
+// patternMatcher es la parte de *http.ServeMux que usa el rate limiter para
+// saber que ruta va a atender el request.
+type patternMatcher interface {
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+// middlewareRateLimit saca un token del bucket global y del de la ruta (si
+// tiene limite propio), con la clave de rateLimitKey. Sin store configurado
+// no limita nada.
+func (cfg *apiConfig) middlewareRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.rateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		who := cfg.rateLimitKey(r)
+
+		res, err := cfg.rateLimiter.Take(r.Context(), "global|"+who, cfg.globalRateLimit)
+		if err == nil {
+			if m, ok := next.(patternMatcher); ok {
+				_, pattern := m.Handler(r)
+				if l, ok := cfg.routeRateLimits[pattern]; ok {
+					var routeRes ratelimit.Result
+					routeRes, err = cfg.rateLimiter.Take(r.Context(), pattern+"|"+who, l)
+					res = tighter(res, routeRes)
+				}
+			}
+		}
+		if err != nil {
+			// Si el store falla se deja pasar: mejor sin limite que caidos
+			log.Printf("rate limit: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		setRateLimitHeaders(w, res)
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			respondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey es el usuario de un access token con firma valida o, si no,
+// la IP. No va a la base: si el token esta revocado o la cuenta suspendida lo
+// rechaza despues el handler, y un request limitado no cuesta ninguna query.
+// Las API keys van por IP: sin la base no se puede saber si una key existe, y
+// con un bucket por key cualquiera inventaria keys para no tener limite.
+func (cfg *apiConfig) rateLimitKey(r *http.Request) string {
+	tokenStr, err := auth.GetBearerToken(r.Header)
+	if err == nil && !strings.HasPrefix(tokenStr, auth.APIKeyPrefix) {
+		if claims, err := cfg.jwtKeys.ParseJWT(tokenStr); err == nil {
+			return "user:" + claims.UserID.String()
+		}
+	}
+	return "ip:" + cfg.clientIP(r)
+}
+
+// tighter devuelve el resultado que se informa en los headers: el que
+// rechazo el request o, si pasaron los dos, el que tiene menos margen.
+func tighter(a, b ratelimit.Result) ratelimit.Result {
+	if a.Allowed != b.Allowed {
+		if !a.Allowed {
+			return a
+		}
+		return b
+	}
+	if b.Remaining < a.Remaining {
+		return b
+	}
+	return a
+}
+
+// setRateLimitHeaders pone los headers RateLimit-* (draft-ietf-httpapi-ratelimit-headers).
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// longestRatePeriod es cuanto tarda en llenarse el bucket mas lento. Un bucket
+// sin uso por mas tiempo que eso esta lleno y se puede borrar.
+func longestRatePeriod(global ratelimit.Limit, routes map[string]ratelimit.Limit) time.Duration {
+	longest := time.Duration(float64(global.Burst) / global.Rate * float64(time.Second))
+	for _, l := range routes {
+		if d := time.Duration(float64(l.Burst) / l.Rate * float64(time.Second)); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// sweepRateLimits borra los buckets viejos cada every hasta que se cancele ctx.
+func (cfg *apiConfig) sweepRateLimits(ctx context.Context, every time.Duration) {
+	idle := longestRatePeriod(cfg.globalRateLimit, cfg.routeRateLimits)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.rateLimiter.Sweep(ctx, idle); err != nil {
+				log.Printf("rate limit sweep: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+// rateLimitedMux arma un mux chico detras del rate limiter.
+func rateLimitedMux(cfg *apiConfig) http.Handler {
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	mux.HandleFunc("POST /api/chirps", ok)
+	mux.HandleFunc("GET /api/chirps", ok)
+	return cfg.middlewareRateLimit(mux)
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	cfg.rateLimiter = ratelimit.NewMemory()
+	cfg.globalRateLimit = ratelimit.PerPeriod(5, time.Minute)
+	cfg.routeRateLimits = map[string]ratelimit.Limit{
+		"POST /api/chirps": ratelimit.PerPeriod(2, time.Minute),
+	}
+	h := rateLimitedMux(cfg)
+
+	do := func(method, auth, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/chirps", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	userA := bearer(t, uuid.New())
+
+	// La ruta permite 2; los headers muestran el bucket mas ajustado
+	for want := 1; want >= 0; want-- {
+		rec := do(http.MethodPost, userA, "")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d", rec.Code)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != strconv.Itoa(want) {
+			t.Errorf("headers = %v", rec.Header())
+		}
+	}
+	rec := do(http.MethodPost, userA, "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Fatalf("third POST: %d %v", rec.Code, rec.Header())
+	}
+
+	// Las lecturas solo tienen el global (5, ya se usaron 3)
+	if rec := do(http.MethodGet, userA, ""); rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "5" || rec.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("GET: %d %v", rec.Code, rec.Header())
+	}
+	do(http.MethodGet, userA, "")
+	if rec := do(http.MethodGet, userA, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("global limit not enforced: %d", rec.Code)
+	}
+
+	// Otro usuario desde la misma IP tiene su propio bucket
+	if rec := do(http.MethodPost, bearer(t, uuid.New()), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("other user limited: %d", rec.Code)
+	}
+	// Los anonimos van por IP
+	do(http.MethodPost, "", "203.0.113.1:1234")
+	do(http.MethodPost, "", "203.0.113.1:1234")
+	if rec := do(http.MethodPost, "", "203.0.113.1:5678"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous IP not limited: %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "", "203.0.113.2:1234"); rec.Code != http.StatusNoContent {
+		t.Errorf("other IP limited: %d", rec.Code)
+	}
+	// Un token invalido cuenta como anonimo
+	if rec := do(http.MethodPost, "Bearer nope", "203.0.113.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("invalid token got its own bucket: %d", rec.Code)
+	}
+	// Una API key tambien: si no, inventar keys daria buckets nuevos
+	if rec := do(http.MethodPost, "Bearer "+auth.APIKeyPrefix+"made-up", "203.0.113.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("API key got its own bucket: %d", rec.Code)
+	}
+
+	// La clave sale sin ir a la base; autenticar es cosa del handler
+	for _, q := range []string{"IsUserSuspended", "AuthenticateAPIKey"} {
+		if n := len(f.called(q)); n != 0 {
+			t.Errorf("%s called %d times", q, n)
+		}
+	}
+}
+
+func TestMiddlewareRateLimitPostgres(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	cfg.rateLimiter = ratelimit.NewPostgres(cfg.db)
+	cfg.globalRateLimit = ratelimit.PerPeriod(300, time.Minute)
+	cfg.routeRateLimits = map[string]ratelimit.Limit{
+		"POST /api/chirps": ratelimit.PerPeriod(10, time.Minute),
+	}
+	f.on("TakeRateLimitToken", func(args []driver.Value) ([][]driver.Value, error) {
+		if args[0] == "POST /api/chirps|ip:192.0.2.1" {
+			return [][]driver.Value{{0.5, false}}, nil
+		}
+		return [][]driver.Value{{299.0, true}}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+	rec := httptest.NewRecorder()
+	rateLimitedMux(cfg).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3" || rec.Header().Get("RateLimit-Limit") != "10" {
+		t.Fatalf("%d %v", rec.Code, rec.Header())
+	}
+	calls := f.called("TakeRateLimitToken")
+	if len(calls) != 2 || calls[0][0] != "global|ip:192.0.2.1" || calls[1][1] != 10.0 {
+		t.Errorf("TakeRateLimitToken calls = %v", calls)
+	}
+}
+
+func TestMiddlewareRateLimitStoreError(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	cfg.rateLimiter = ratelimit.NewPostgres(cfg.db)
+	cfg.globalRateLimit = ratelimit.PerPeriod(1, time.Minute)
+	f.on("TakeRateLimitToken", func(args []driver.Value) ([][]driver.Value, error) {
+		return nil, errors.New("db down")
+	})
+
+	rec := httptest.NewRecorder()
+	rateLimitedMux(cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want the request to go through", rec.Code)
+	}
+}
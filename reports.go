@@ -0,0 +1,323 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxReportReasonLength = 500
+
+// Lo que puede decidir un moderador sobre un chirp reportado
+const (
+	decisionHide    = "hide"
+	decisionDismiss = "dismiss"
+	decisionSuspend = "suspend"
+)
+
+var errNoPendingReports = errors.New("no pending reports")
+
+type reportRequest struct {
+	Reason string `json:"reason"`
+}
+
+type reportResponse struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type reportQueueItem struct {
+	ChirpID         uuid.UUID `json:"chirp_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Body            string    `json:"body"`
+	Hidden          bool      `json:"hidden"`
+	ReportCount     int64     `json:"report_count"`
+	Reasons         []string  `json:"reasons"`
+	FirstReportedAt time.Time `json:"first_reported_at"`
+}
+
+type resolveReportRequest struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+type moderationDecisionResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	ChirpID   uuid.UUID  `json:"chirp_id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Action    string     `json:"action"`
+	Note      string     `json:"note"`
+	DecidedBy *uuid.UUID `json:"decided_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func newModerationDecisionResponse(d database.ModerationDecision) moderationDecisionResponse {
+	res := moderationDecisionResponse{
+		ID:        d.ID,
+		ChirpID:   d.ChirpID,
+		UserID:    d.UserID,
+		Action:    d.Action,
+		Note:      d.Note,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.DecidedBy.Valid {
+		res.DecidedBy = &d.DecidedBy.UUID
+	}
+	return res
+}
+
+// POST /api/chirps/{chirpID}/report
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirpID")
+		return
+	}
+
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || utf8.RuneCountInString(req.Reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, "reason must be 1-500 characters")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "chirp not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get chirp")
+		return
+	}
+	if dbChirp.HiddenAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+	if dbChirp.UserID == userID {
+		respondWithError(w, http.StatusBadRequest, "cannot report your own chirp")
+		return
+	}
+
+	report, err := cfg.db.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    chirpID,
+		ReporterID: uuid.NullUUID{UUID: userID, Valid: true},
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		// Ya tiene un reporte pendiente sobre este chirp
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusConflict, "chirp already reported")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not report chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, reportResponse{
+		ID:        report.ID,
+		ChirpID:   report.ChirpID,
+		Reason:    report.Reason,
+		CreatedAt: report.CreatedAt,
+	})
+}
+
+// GET /admin/reports?limit=N: cola de chirps con reportes pendientes
+func (cfg *apiConfig) handlerAdminListReports(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, defaultPageLimit, maxPageLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := cfg.db.ListPendingReports(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get reports")
+		return
+	}
+
+	res := make([]reportQueueItem, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, reportQueueItem{
+			ChirpID:         row.ChirpID,
+			UserID:          row.UserID,
+			Body:            row.Body,
+			Hidden:          row.HiddenAt.Valid,
+			ReportCount:     row.ReportCount,
+			Reasons:         row.Reasons,
+			FirstReportedAt: row.FirstReportedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// POST /admin/reports/{chirpID}/resolve: resuelve todos los reportes
+// pendientes del chirp con una decision (hide, dismiss o suspend) y la registra.
+func (cfg *apiConfig) handlerAdminResolveReport(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirpID")
+		return
+	}
+
+	var req resolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	switch req.Action {
+	case decisionHide, decisionDismiss, decisionSuspend:
+	default:
+		respondWithError(w, http.StatusBadRequest, "action must be hide, dismiss or suspend")
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "chirp not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get chirp")
+		return
+	}
+
+	if req.Action == decisionSuspend && !cfg.canModerate(w, r, dbChirp.UserID) {
+		return
+	}
+
+	var decision database.ModerationDecision
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		decision, err = q.CreateModerationDecision(r.Context(), database.CreateModerationDecisionParams{
+			ChirpID:   chirpID,
+			UserID:    dbChirp.UserID,
+			Action:    req.Action,
+			Note:      strings.TrimSpace(req.Note),
+			DecidedBy: callerID(r),
+		})
+		if err != nil {
+			return err
+		}
+
+		n, err := q.ResolveReports(r.Context(), database.ResolveReportsParams{
+			ChirpID:    chirpID,
+			DecisionID: uuid.NullUUID{UUID: decision.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errNoPendingReports
+		}
+
+		switch req.Action {
+		case decisionHide:
+			return q.HideChirp(r.Context(), chirpID)
+		case decisionSuspend:
+			// Sin refresh tokens no puede renovar la sesion, y sus API keys
+			// y apps autorizadas no vuelven a servir aunque se levante la
+			// suspension
+			if err := q.SuspendUser(r.Context(), dbChirp.UserID); err != nil {
+				return err
+			}
+			if err := q.RevokeUserAPIKeys(r.Context(), dbChirp.UserID); err != nil {
+				return err
+			}
+			if err := q.RevokeUserOAuthGrants(r.Context(), dbChirp.UserID); err != nil {
+				return err
+			}
+			return q.RevokeUserTokens(r.Context(), dbChirp.UserID)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errNoPendingReports) {
+			respondWithError(w, http.StatusNotFound, "no pending reports for chirp")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not resolve reports")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newModerationDecisionResponse(decision))
+}
+
+// canModerate deja suspender (o levantar la suspension de) userID solo si su
+// rol esta por debajo del de quien llama: un moderador no puede suspender a
+// otro moderador ni a un admin. Si no, responde y devuelve false.
+func (cfg *apiConfig) canModerate(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	target, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return false
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get user")
+		return false
+	}
+	if !callerRole(r).Outranks(auth.Role(target.Role)) {
+		respondWithError(w, http.StatusForbidden, "cannot moderate a user with the same or a higher role")
+		return false
+	}
+	return true
+}
+
+// DELETE /admin/users/{userID}/suspension: levanta la suspension. Los tokens,
+// API keys y apps autorizadas que se revocaron no vuelven: el usuario entra
+// de nuevo con su password.
+func (cfg *apiConfig) handlerAdminUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid userID")
+		return
+	}
+	if !cfg.canModerate(w, r, userID) {
+		return
+	}
+
+	if err := cfg.db.UnsuspendUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not lift suspension")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /admin/moderation/decisions?limit=N: historial de decisiones
+func (cfg *apiConfig) handlerAdminListDecisions(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, defaultPageLimit, maxPageLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := cfg.db.ListModerationDecisions(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get decisions")
+		return
+	}
+
+	res := make([]moderationDecisionResponse, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, newModerationDecisionResponse(row))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
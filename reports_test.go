@@ -0,0 +1,304 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerReportChirp(t *testing.T) {
+	author, reporter := uuid.New(), uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: "c", UserID: author}
+	hidden := chirp
+	hidden.HiddenAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	tests := []struct {
+		name       string
+		user       uuid.UUID
+		body       string
+		setup      func(f *fakeDB)
+		wantStatus int
+	}{
+		{
+			name:       "empty reason",
+			user:       reporter,
+			body:       `{"reason":"  "}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "own chirp",
+			user:       author,
+			body:       `{"reason":"spam"}`,
+			setup:      func(f *fakeDB) { f.returns("GetChirp", chirpRow(chirp)) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "hidden chirp",
+			user:       reporter,
+			body:       `{"reason":"spam"}`,
+			setup:      func(f *fakeDB) { f.returns("GetChirp", chirpRow(hidden)) },
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "already reported",
+			user: reporter,
+			body: `{"reason":"spam"}`,
+			setup: func(f *fakeDB) {
+				f.returns("GetChirp", chirpRow(chirp))
+				f.returns("CreateReport")
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "reported",
+			user: reporter,
+			body: `{"reason":"spam"}`,
+			setup: func(f *fakeDB) {
+				f.returns("GetChirp", chirpRow(chirp))
+				f.on("CreateReport", func(args []driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{uuid.NewString(), args[0], args[1], args[2], time.Now(), nil, nil}}, nil
+				})
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps/"+chirp.ID.String()+"/report", strings.NewReader(tc.body))
+			req.SetPathValue("chirpID", chirp.ID.String())
+			req.Header.Set("Authorization", bearer(t, tc.user))
+			rec := httptest.NewRecorder()
+			cfg.handlerReportChirp(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus == http.StatusCreated {
+				args := f.called("CreateReport")[0]
+				if args[0] != chirp.ID.String() || args[1] != reporter.String() || args[2] != "spam" {
+					t.Errorf("CreateReport args = %v", args)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerAdminResolveReport(t *testing.T) {
+	author, moderator := uuid.New(), uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: "c", UserID: author}
+
+	tests := []struct {
+		name        string
+		body        string
+		callerRole  auth.Role
+		authorRole  auth.Role
+		pending     int
+		wantStatus  int
+		wantQueries []string
+	}{
+		{name: "invalid action", body: `{"action":"ban"}`, wantStatus: http.StatusBadRequest},
+		{name: "nothing pending", body: `{"action":"dismiss"}`, pending: 0, wantStatus: http.StatusNotFound},
+		{name: "dismiss", body: `{"action":"dismiss"}`, pending: 2, wantStatus: http.StatusOK},
+		{name: "hide", body: `{"action":"hide","note":"spam"}`, pending: 1, wantStatus: http.StatusOK, wantQueries: []string{"HideChirp"}},
+		{name: "suspend", body: `{"action":"suspend"}`, pending: 1, wantStatus: http.StatusOK, wantQueries: []string{"SuspendUser", "RevokeUserAPIKeys", "RevokeUserOAuthGrants", "RevokeUserTokens"}},
+		{name: "moderator suspends a moderator", body: `{"action":"suspend"}`, authorRole: auth.RoleModerator, pending: 1, wantStatus: http.StatusForbidden},
+		{name: "moderator suspends an admin", body: `{"action":"suspend"}`, authorRole: auth.RoleAdmin, pending: 1, wantStatus: http.StatusForbidden},
+		{name: "admin suspends a moderator", body: `{"action":"suspend"}`, callerRole: auth.RoleAdmin, authorRole: auth.RoleModerator, pending: 1, wantStatus: http.StatusOK, wantQueries: []string{"SuspendUser", "RevokeUserAPIKeys", "RevokeUserOAuthGrants", "RevokeUserTokens"}},
+		{name: "admin suspends an admin", body: `{"action":"suspend"}`, callerRole: auth.RoleAdmin, authorRole: auth.RoleAdmin, pending: 1, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.callerRole == "" {
+				tc.callerRole = auth.RoleModerator
+			}
+			if tc.authorRole == "" {
+				tc.authorRole = auth.RoleUser
+			}
+			cfg, f := newTestConfig(t)
+			f.returns("GetChirp", chirpRow(chirp))
+			f.returns("GetUserByID", userRow(database.User{ID: author, Email: "a@example.com", Role: string(tc.authorRole)}))
+			f.on("CreateModerationDecision", func(args []driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{uuid.NewString(), args[0], args[1], args[2], args[3], args[4], time.Now()}}, nil
+			})
+			f.returns("ResolveReports", make([][]driver.Value, tc.pending)...)
+			f.returns("HideChirp")
+			f.returns("SuspendUser")
+			f.returns("RevokeUserAPIKeys")
+			f.returns("RevokeUserOAuthGrants")
+			f.returns("RevokeUserTokens")
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/reports/"+chirp.ID.String()+"/resolve", strings.NewReader(tc.body))
+			req.SetPathValue("chirpID", chirp.ID.String())
+			req.Header.Set("Authorization", bearerWithRole(t, cfg, moderator, tc.callerRole))
+			rec := httptest.NewRecorder()
+			cfg.requireRole(auth.RoleModerator, cfg.handlerAdminResolveReport)(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus == http.StatusBadRequest {
+				return
+			}
+			// Sin rango suficiente no se registra ninguna decision
+			if tc.wantStatus == http.StatusForbidden {
+				if n := len(f.called("CreateModerationDecision")) + len(f.called("SuspendUser")); n != 0 {
+					t.Errorf("%d moderation queries ran", n)
+				}
+				return
+			}
+			// La decision se crea antes de resolver; sin reportes pendientes la tx hace rollback
+			if args := f.called("CreateModerationDecision"); len(args) != 1 || args[0][1] != author.String() || args[0][4] != moderator.String() {
+				t.Errorf("CreateModerationDecision calls = %v", args)
+			}
+			for _, q := range []string{"HideChirp", "SuspendUser", "RevokeUserAPIKeys", "RevokeUserOAuthGrants", "RevokeUserTokens"} {
+				want := 0
+				for _, w := range tc.wantQueries {
+					if w == q {
+						want = 1
+					}
+				}
+				if got := len(f.called(q)); got != want {
+					t.Errorf("%s called %d times, want %d", q, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerAdminUnsuspendUser(t *testing.T) {
+	caller := uuid.New()
+
+	tests := []struct {
+		name       string
+		userID     string
+		callerRole auth.Role
+		target     *database.User
+		wantStatus int
+	}{
+		{name: "invalid id", userID: "nope", callerRole: auth.RoleModerator, wantStatus: http.StatusBadRequest},
+		{name: "unknown user", userID: uuid.NewString(), callerRole: auth.RoleModerator, wantStatus: http.StatusNotFound},
+		{name: "user", callerRole: auth.RoleModerator, target: &database.User{Role: string(auth.RoleUser)}, wantStatus: http.StatusNoContent},
+		{name: "moderator by a moderator", callerRole: auth.RoleModerator, target: &database.User{Role: string(auth.RoleModerator)}, wantStatus: http.StatusForbidden},
+		{name: "moderator by an admin", callerRole: auth.RoleAdmin, target: &database.User{Role: string(auth.RoleModerator)}, wantStatus: http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.target != nil {
+				tc.target.ID = uuid.New()
+				tc.target.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				tc.userID = tc.target.ID.String()
+				f.returns("GetUserByID", userRow(*tc.target))
+			} else {
+				f.returns("GetUserByID")
+			}
+			f.returns("UnsuspendUser")
+
+			req := httptest.NewRequest(http.MethodDelete, "/admin/users/"+tc.userID+"/suspension", nil)
+			req.SetPathValue("userID", tc.userID)
+			req.Header.Set("Authorization", bearerWithRole(t, cfg, caller, tc.callerRole))
+			rec := httptest.NewRecorder()
+			cfg.requireRole(auth.RoleModerator, cfg.handlerAdminUnsuspendUser)(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			calls := f.called("UnsuspendUser")
+			if tc.wantStatus != http.StatusNoContent {
+				if len(calls) != 0 {
+					t.Errorf("UnsuspendUser called %d times", len(calls))
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0][0] != tc.userID {
+				t.Errorf("UnsuspendUser calls = %v", calls)
+			}
+		})
+	}
+}
+
+func TestSuspendedUserCannotPost(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	f.returns("CreateChirp")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hola"}`))
+	req.Header.Set("Authorization", bearer(t, uuid.New()))
+	rec := httptest.NewRecorder()
+	cfg.handlerChirps(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+// Un access token emitido antes de la suspension deja de servir enseguida,
+// no cuando vence.
+func TestSuspendedUserTokenRejected(t *testing.T) {
+	userID, chirpID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		method  string
+		handler func(cfg *apiConfig) http.HandlerFunc
+	}{
+		{name: "like", method: http.MethodPut, handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerLikeChirp }},
+		{name: "follow", method: http.MethodPost, handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerFollow }},
+		{name: "report", method: http.MethodPost, handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerReportChirp }},
+		{name: "delete chirp", method: http.MethodDelete, handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerDeleteChirp }},
+		{name: "update user", method: http.MethodPut, handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerUsersUpdate }},
+		{name: "moderation", method: http.MethodPost, handler: func(cfg *apiConfig) http.HandlerFunc {
+			return cfg.requireRole(auth.RoleModerator, cfg.handlerAdminResolveReport)
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("IsUserSuspended", []driver.Value{true})
+			f.returns("GetUserAccess", []driver.Value{string(auth.RoleModerator), true})
+
+			req := httptest.NewRequest(tc.method, "/", strings.NewReader(`{}`))
+			req.SetPathValue("chirpID", chirpID.String())
+			req.SetPathValue("userID", uuid.NewString())
+			req.Header.Set("Authorization", bearerWithRole(t, cfg, userID, auth.RoleModerator))
+			rec := httptest.NewRecorder()
+			tc.handler(cfg)(rec, req)
+
+			// Cualquier otra query haria fallar el test en el fakeDB
+			if rec.Code != http.StatusForbidden || decodeError(t, rec) != "account suspended" {
+				t.Errorf("status = %d (%s), want 403 account suspended", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHiddenChirpNotFound(t *testing.T) {
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: time.Now().UTC(), Body: "c", UserID: uuid.New(), HiddenAt: sql.NullTime{Time: time.Now(), Valid: true}}
+	cfg, f := newTestConfig(t)
+	f.returns("GetChirp", chirpRow(chirp))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String(), nil)
+	req.SetPathValue("chirpID", chirp.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerGetChirpById(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
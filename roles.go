@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+type claimsKey struct{}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+type userRoleResponse struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+	Role  string    `json:"role"`
+}
+
+// requireRole solo deja pasar requests con un access token de un usuario
+// cuyo rol alcance para role (401 sin token valido, 403 con un rol menor). El
+// rol se lee de la base y no del token: a un admin que degradan no le sirve
+// el access token que ya tenia. Los claims, con ese rol, quedan en el context
+// para el handler.
+func (cfg *apiConfig) requireRole(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenStr, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		claims, err := cfg.jwtKeys.ParseJWT(tokenStr)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		// Los tokens de clientes OAuth nunca llegan a /admin
+		if claims.Delegated() {
+			respondWithError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+
+		access, err := cfg.db.GetUserAccess(r.Context(), claims.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "could not authenticate")
+			return
+		}
+		// Un moderador suspendido pierde el acceso aunque su token no haya vencido
+		if access.Suspended {
+			respondAuthError(w, errAccountSuspended)
+			return
+		}
+		current := *claims
+		current.Role = auth.Role(access.Role)
+		if !current.Role.Allows(role) {
+			respondWithError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, &current)))
+	}
+}
+
+// promoteAdmin le da el rol admin a la cuenta con ese email. Tiene que estar
+// verificada: si no, cualquiera podria registrar el email antes que el dueno.
+func promoteAdmin(ctx context.Context, db *database.Queries, email string) error {
+	if _, err := db.PromoteAdmin(ctx, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no verified account with email %q", email)
+		}
+		return err
+	}
+	return nil
+}
+
+// callerID devuelve el usuario autenticado por requireRole, si lo hay.
+func callerID(r *http.Request) uuid.NullUUID {
+	claims, ok := r.Context().Value(claimsKey{}).(*auth.Claims)
+	if !ok {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: claims.UserID, Valid: true}
+}
+
+// callerRole devuelve el rol del usuario autenticado por requireRole.
+func callerRole(r *http.Request) auth.Role {
+	claims, ok := r.Context().Value(claimsKey{}).(*auth.Claims)
+	if !ok {
+		return ""
+	}
+	return claims.Role
+}
+
+// PUT /admin/users/{userID}/role: asigna un rol
+func (cfg *apiConfig) handlerAdminGrantRole(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "role must be user, moderator or admin")
+		return
+	}
+
+	cfg.setUserRole(w, r, role)
+}
+
+// DELETE /admin/users/{userID}/role: vuelve a ser un usuario comun
+func (cfg *apiConfig) handlerAdminRevokeRole(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserRole(w, r, auth.RoleUser)
+}
+
+func (cfg *apiConfig) setUserRole(w http.ResponseWriter, r *http.Request, role auth.Role) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid userID")
+		return
+	}
+
+	// Asi un admin no se puede dejar a si mismo (y quizas al sistema) sin admins
+	if caller := callerID(r); caller.Valid && caller.UUID == userID {
+		respondWithError(w, http.StatusBadRequest, "cannot change your own role")
+		return
+	}
+
+	dbUser, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: string(role),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not update role")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userRoleResponse{
+		ID:    dbUser.ID,
+		Email: dbUser.Email,
+		Role:  dbUser.Role,
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestRequireRole(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		auth       func(cfg *apiConfig) string
+		dbRole     auth.Role
+		wantStatus int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "garbage token", auth: func(*apiConfig) string { return "Bearer nope" }, wantStatus: http.StatusUnauthorized},
+		{name: "user", auth: func(*apiConfig) string { return bearer(t, userID) }, dbRole: auth.RoleUser, wantStatus: http.StatusForbidden},
+		{name: "moderator", auth: func(*apiConfig) string { return bearer(t, userID) }, dbRole: auth.RoleModerator, wantStatus: http.StatusNoContent},
+		{name: "admin", auth: func(*apiConfig) string { return bearer(t, userID) }, dbRole: auth.RoleAdmin, wantStatus: http.StatusNoContent},
+		// El rol del token no cuenta: manda el de la base
+		{name: "demoted admin", auth: func(cfg *apiConfig) string { return bearerWithRole(t, cfg, userID, auth.RoleAdmin) }, dbRole: auth.RoleUser, wantStatus: http.StatusForbidden},
+		{name: "promoted user", auth: func(cfg *apiConfig) string { return bearerWithRole(t, cfg, userID, auth.RoleUser) }, dbRole: auth.RoleModerator, wantStatus: http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			var gotCaller uuid.NullUUID
+			var gotRole auth.Role
+			h := cfg.requireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+				gotCaller, gotRole = callerID(r), callerRole(r)
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/reports", nil)
+			if tc.auth != nil {
+				req.Header.Set("Authorization", tc.auth(cfg))
+			}
+			f.setRole(userID, tc.dbRole)
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusNoContent && (gotCaller.UUID != userID || gotRole != tc.dbRole) {
+				t.Errorf("caller = %v with role %q, want %v with %q", gotCaller, gotRole, userID, tc.dbRole)
+			}
+		})
+	}
+}
+
+func TestAdminUserRole(t *testing.T) {
+	adminID, target := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		method     string
+		userID     string
+		body       string
+		found      bool
+		wantStatus int
+		wantRole   string
+	}{
+		{name: "grant", method: http.MethodPut, userID: target.String(), body: `{"role":"moderator"}`, found: true, wantStatus: http.StatusOK, wantRole: "moderator"},
+		{name: "revoke", method: http.MethodDelete, userID: target.String(), found: true, wantStatus: http.StatusOK, wantRole: "user"},
+		{name: "unknown role", method: http.MethodPut, userID: target.String(), body: `{"role":"root"}`, wantStatus: http.StatusBadRequest},
+		{name: "own role", method: http.MethodDelete, userID: adminID.String(), wantStatus: http.StatusBadRequest},
+		{name: "invalid id", method: http.MethodDelete, userID: "nope", wantStatus: http.StatusBadRequest},
+		{name: "not found", method: http.MethodPut, userID: target.String(), body: `{"role":"admin"}`, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.found {
+				f.returns("SetUserRole", userRow(database.User{ID: target, Email: "t@example.com", Role: tc.wantRole}))
+			} else {
+				f.returns("SetUserRole")
+			}
+
+			handler := cfg.handlerAdminGrantRole
+			if tc.method == http.MethodDelete {
+				handler = cfg.handlerAdminRevokeRole
+			}
+			req := httptest.NewRequest(tc.method, "/admin/users/"+tc.userID+"/role", strings.NewReader(tc.body))
+			req.SetPathValue("userID", tc.userID)
+			req.Header.Set("Authorization", bearerWithRole(t, cfg, adminID, auth.RoleAdmin))
+			rec := httptest.NewRecorder()
+			cfg.requireRole(auth.RoleAdmin, handler)(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				if n := len(f.called("SetUserRole")); tc.wantStatus == http.StatusBadRequest && n != 0 {
+					t.Errorf("SetUserRole called %d times", n)
+				}
+				return
+			}
+			args := f.called("SetUserRole")[0]
+			if args[0] != target.String() || args[1] != tc.wantRole {
+				t.Errorf("SetUserRole args = %v", args)
+			}
+			if !strings.Contains(rec.Body.String(), `"role":"`+tc.wantRole+`"`) {
+				t.Errorf("body = %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPromoteAdmin(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	// Solo matchea una cuenta verificada; la otra ni la ve el UPDATE
+	f.on("PromoteAdmin", func(args []driver.Value) ([][]driver.Value, error) {
+		if args[0] != "boss@example.com" {
+			return nil, nil
+		}
+		return [][]driver.Value{userRow(database.User{ID: uuid.New(), Email: "boss@example.com", Role: "admin"})}, nil
+	})
+
+	if err := promoteAdmin(context.Background(), cfg.db, "boss@example.com"); err != nil {
+		t.Errorf("promoteAdmin: %v", err)
+	}
+	if err := promoteAdmin(context.Background(), cfg.db, "unverified@example.com"); err == nil {
+		t.Error("expected error for an email without a verified account")
+	}
+}
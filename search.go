@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+type searchResult struct {
+	chirpResponse
+	Rank float32 `json:"rank"`
+	// HTML: el body escapado con los terminos encontrados entre <mark></mark>
+	Headline string `json:"headline"`
+}
+
+type searchPageResponse struct {
+	Chirps     []searchResult `json:"chirps"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Delimitadores que usa SearchChirps en ts_headline
+var headlineMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// GET /api/chirps/search?q=...: resultados por relevancia, con la misma
+// paginacion (cursor + limit) que GET /api/chirps.
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "q required")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.SearchChirpsParams{
+		Query:     query,
+		PageLimit: page.Limit + 1,
+	}
+	if page.Cursor != nil {
+		// Un cursor de /api/chirps no sirve aca: le falta el rank
+		if page.Cursor.Rank == nil {
+			respondWithError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		params.AfterRank = sql.NullFloat64{Float64: float64(*page.Cursor.Rank), Valid: true}
+		params.AfterCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	rows, err := cfg.db.SearchChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not search chirps")
+		return
+	}
+
+	res := searchPageResponse{Chirps: make([]searchResult, 0, len(rows))}
+	if len(rows) > int(page.Limit) {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		rank := last.Rank
+		res.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID, Rank: &rank})
+	}
+
+	dbChirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		dbChirps = append(dbChirps, database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			ParentID:  row.ParentID,
+		})
+	}
+	chirps, err := cfg.chirpResponses(r.Context(), dbChirps, cfg.viewerID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not search chirps")
+		return
+	}
+
+	for i, row := range rows {
+		res.Chirps = append(res.Chirps, searchResult{
+			chirpResponse: chirps[i],
+			Rank:          row.Rank,
+			Headline:      headlineMarks.Replace(html.EscapeString(row.Headline)),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHandlerSearchChirps(t *testing.T) {
+	cfg, f := newTestConfig(t)
+
+	now := time.Now().UTC()
+	first, second := uuid.New(), uuid.New()
+	searchRow := func(id uuid.UUID, rank float32, headline string) []driver.Value {
+		return []driver.Value{id.String(), now, now, "body", uuid.NewString(), nil, float64(rank), headline}
+	}
+	f.returns("SearchChirps",
+		searchRow(first, 0.9, "<b>\x02gopher\x03</b>"),
+		searchRow(second, 0.5, "\x02gopher\x03"),
+	)
+	f.returns("GetChirpStats")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/search?q=gopher&limit=1", nil)
+	rec := httptest.NewRecorder()
+	cfg.handlerSearchChirps(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	var res searchPageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Chirps) != 1 || res.Chirps[0].ID != first {
+		t.Fatalf("unexpected results %+v", res.Chirps)
+	}
+	// El HTML del body se escapa, solo quedan los <mark> del resaltado
+	if got, want := res.Chirps[0].Headline, "&lt;b&gt;<mark>gopher</mark>&lt;/b&gt;"; got != want {
+		t.Errorf("headline = %q, want %q", got, want)
+	}
+
+	next, err := decodeCursor(res.NextCursor)
+	if err != nil || next.Rank == nil || *next.Rank != 0.9 || next.ID != first {
+		t.Fatalf("next_cursor = %+v (%v)", next, err)
+	}
+
+	// La segunda pagina manda el rank del cursor
+	req = httptest.NewRequest(http.MethodGet, "/api/chirps/search?q=gopher&limit=1&cursor="+res.NextCursor, nil)
+	rec = httptest.NewRecorder()
+	cfg.handlerSearchChirps(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if got := f.called("SearchChirps")[1][1]; got != float64(float32(0.9)) {
+		t.Errorf("after_rank arg = %v", got)
+	}
+}
+
+func TestHandlerSearchChirpsValidation(t *testing.T) {
+	listCursor := encodeCursor(pageCursor{CreatedAt: time.Now(), ID: uuid.New()})
+
+	for _, query := range []string{"", "q=+", "q=go&cursor=" + listCursor} {
+		cfg, _ := newTestConfig(t)
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps/search?"+query, nil)
+		rec := httptest.NewRecorder()
+		cfg.handlerSearchChirps(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
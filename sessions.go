@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// Los user agents largos se cortan; alcanza para reconocer el dispositivo
+const maxSessionUserAgent = 256
+
+// Una sesion es una familia de refresh tokens: el ID es el family_id, que
+// sobrevive a las rotaciones y no sirve para hacer refresh.
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func sessionUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) <= maxSessionUserAgent {
+		return ua
+	}
+	ua = ua[:maxSessionUserAgent]
+	// Que el corte no deje medio caracter
+	for !utf8.ValidString(ua) {
+		ua = ua[:len(ua)-1]
+	}
+	return ua
+}
+
+// GET /api/sessions: las sesiones activas del usuario, la mas reciente primero
+func (cfg *apiConfig) handlerListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListUserSessions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not list sessions")
+		return
+	}
+
+	sessions := make([]sessionResponse, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, sessionResponse{
+			ID:         row.FamilyID,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			UserAgent:  row.UserAgent,
+			IP:         row.Ip,
+			ExpiresAt:  row.ExpiresAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// DELETE /api/sessions/{sessionID}: cierra una sesion. El access token que
+// ya tenga ese dispositivo sigue valido hasta que venza.
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid sessionID")
+		return
+	}
+
+	// Filtra por usuario: la sesion de otro da 404 igual que una que no existe
+	n, err := cfg.db.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not revoke session")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/sessions: cierra todas las sesiones, incluida la actual, y le
+// saca el acceso a las apps autorizadas
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		if err := q.RevokeUserOAuthGrants(r.Context(), userID); err != nil {
+			return err
+		}
+		return q.RevokeUserTokens(r.Context(), userID)
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not revoke sessions")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
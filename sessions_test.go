@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerListSessions(t *testing.T) {
+	userID := uuid.New()
+	familyID := uuid.New()
+	started := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	used := time.Now().UTC().Truncate(time.Second)
+
+	cfg, f := newTestConfig(t)
+	f.returns("ListUserSessions", []driver.Value{familyID.String(), started, used, "Firefox", "198.51.100.7", used.Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", bearer(t, userID))
+	rec := httptest.NewRecorder()
+	cfg.handlerListSessions(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	if args := f.called("ListUserSessions")[0]; args[0] != userID.String() {
+		t.Errorf("listed sessions of %v", args[0])
+	}
+	var res []sessionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].ID != familyID || !res[0].CreatedAt.Equal(started) || !res[0].LastUsedAt.Equal(used) ||
+		res[0].UserAgent != "Firefox" || res[0].IP != "198.51.100.7" {
+		t.Errorf("sessions = %+v", res)
+	}
+}
+
+func TestHandlerListSessionsEmpty(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	f.returns("ListUserSessions")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", bearer(t, uuid.New()))
+	rec := httptest.NewRecorder()
+	cfg.handlerListSessions(rec, req)
+
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerRevokeSession(t *testing.T) {
+	userID := uuid.New()
+	familyID := uuid.New()
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		revoked    bool
+		auth       string
+		wantStatus int
+	}{
+		{name: "revokes", sessionID: familyID.String(), revoked: true, wantStatus: http.StatusNoContent},
+		{name: "not found or not yours", sessionID: familyID.String(), wantStatus: http.StatusNotFound},
+		{name: "invalid id", sessionID: "old-token", wantStatus: http.StatusBadRequest},
+		{name: "no token", sessionID: familyID.String(), auth: "-", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.revoked {
+				f.returns("RevokeUserSession", nil)
+			} else {
+				f.returns("RevokeUserSession")
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+tc.sessionID, nil)
+			req.SetPathValue("sessionID", tc.sessionID)
+			if tc.auth == "" {
+				req.Header.Set("Authorization", bearer(t, userID))
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerRevokeSession(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			calls := f.called("RevokeUserSession")
+			if tc.wantStatus == http.StatusBadRequest || tc.wantStatus == http.StatusUnauthorized {
+				if len(calls) != 0 {
+					t.Error("RevokeUserSession should not run")
+				}
+				return
+			}
+			if args := calls[0]; args[0] != userID.String() || args[1] != familyID.String() {
+				t.Errorf("RevokeUserSession args = %v", args)
+			}
+		})
+	}
+}
+
+func TestHandlerRevokeAllSessions(t *testing.T) {
+	userID := uuid.New()
+	cfg, f := newTestConfig(t)
+	f.returns("RevokeUserOAuthGrants")
+	f.returns("RevokeUserTokens")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/sessions", nil)
+	req.Header.Set("Authorization", bearer(t, userID))
+	rec := httptest.NewRecorder()
+	cfg.handlerRevokeAllSessions(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	// Tambien corta las apps autorizadas, no solo los logins
+	for _, q := range []string{"RevokeUserOAuthGrants", "RevokeUserTokens"} {
+		if calls := f.called(q); len(calls) != 1 || calls[0][0] != userID.String() {
+			t.Errorf("%s calls = %v", q, calls)
+		}
+	}
+}
+
+func TestIssueTokensRecordsDevice(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	userID := uuid.New()
+	returnsNewToken(f, userID)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	req.Header.Set("User-Agent", strings.Repeat("€", maxSessionUserAgent))
+	res, err := cfg.issueTokens(req, database.User{ID: userID, Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := f.called("CreateToken")[0]
+	ua := args[4].(string)
+	if len(ua) != maxSessionUserAgent-1 || !utf8.ValidString(ua) || args[5] != "192.0.2.1" {
+		t.Errorf("CreateToken device = %q %v", ua, args[5])
+	}
+	// En la DB va el hash; el ID de la sesion tampoco es el token
+	if !strings.HasPrefix(res.RefreshToken, auth.RefreshTokenPrefix) || args[0] != auth.HashToken(res.RefreshToken) || args[3] == res.RefreshToken {
+		t.Errorf("refresh token %q stored as %v (family %v)", res.RefreshToken, args[0], args[3])
+	}
+}
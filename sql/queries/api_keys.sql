@@ -0,0 +1,36 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, user_id, name, key_hash, hint, scopes, created_at, expires_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), $6)
+RETURNING *;
+
+-- name: ListUserAPIKeys :many
+SELECT *
+FROM api_keys
+WHERE user_id = $1
+AND   revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1
+AND   user_id = $2
+AND   revoked_at IS NULL;
+
+-- name: RevokeUserAPIKeys :exec
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE user_id = $1
+AND   revoked_at IS NULL;
+
+-- name: AuthenticateAPIKey :one
+-- Busca una key vigente de una cuenta no suspendida por su hash y marca el uso.
+UPDATE api_keys
+SET last_used_at = NOW()
+FROM users
+WHERE api_keys.key_hash = $1
+AND   api_keys.revoked_at IS NULL
+AND   (api_keys.expires_at IS NULL OR api_keys.expires_at > NOW())
+AND   users.id = api_keys.user_id
+AND   users.suspended_at IS NULL
+RETURNING api_keys.user_id, api_keys.scopes;
@@ -1,17 +1,104 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+-- No inserta nada (sql.ErrNoRows) si el autor esta suspendido.
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id)
+SELECT gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+WHERE NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = $2
+  AND   users.suspended_at IS NOT NULL
+)
 RETURNING *;
 --
 
 -- name: GetChirps :many
 SELECT *
 FROM chirps
-ORDER BY created_at ASC;
+WHERE hidden_at IS NULL
+  AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+  AND (
+    sqlc.narg(after_created_at)::timestamp IS NULL
+    OR (NOT sqlc.arg(descending)::bool AND (created_at, id) > (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_id)::uuid))
+    OR (sqlc.arg(descending)::bool AND (created_at, id) < (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_id)::uuid))
+  )
+ORDER BY
+  CASE WHEN sqlc.arg(descending)::bool THEN created_at END DESC,
+  CASE WHEN sqlc.arg(descending)::bool THEN id END DESC,
+  created_at ASC,
+  id ASC
+LIMIT sqlc.arg(page_limit);
 --
 
 -- name: GetChirp :one
 SELECT *
 FROM chirps 
 WHERE id = $1;
---
\ No newline at end of file
+--
+
+-- name: DeleteChirp :exec
+DELETE FROM chirps
+WHERE id = $1;
+
+-- name: GetChirpStats :many
+SELECT
+  c.id,
+  (SELECT COUNT(*) FROM chirps r WHERE r.parent_id = c.id AND r.hidden_at IS NULL) AS reply_count,
+  (SELECT COUNT(*) FROM likes l WHERE l.chirp_id = c.id) AS like_count,
+  EXISTS (
+    SELECT 1 FROM likes l
+    WHERE l.chirp_id = c.id
+    AND   l.user_id = sqlc.narg(viewer_id)::uuid
+  ) AS liked_by_me
+FROM chirps c
+WHERE c.id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, 1 AS depth
+    FROM chirps c
+    WHERE c.id = (SELECT p.parent_id FROM chirps p WHERE p.id = sqlc.arg(id))
+    AND   c.hidden_at IS NULL
+  UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.parent_id
+    WHERE a.depth < sqlc.arg(max_depth)::int
+    AND   c.hidden_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, parent_id, depth
+FROM ancestors
+ORDER BY depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, 1 AS depth
+    FROM chirps c
+    WHERE c.parent_id = sqlc.arg(id)
+    AND   c.hidden_at IS NULL
+  UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id, d.depth + 1
+    FROM chirps c
+    JOIN descendants d ON c.parent_id = d.id
+    WHERE d.depth < sqlc.arg(max_depth)::int
+    AND   c.hidden_at IS NULL
+)
+SELECT id, created_at, updated_at, body, user_id, parent_id, depth
+FROM descendants
+ORDER BY depth ASC, created_at ASC, id ASC
+LIMIT sqlc.arg(max_rows);
+
+-- name: SearchChirps :many
+-- Los fragmentos resaltados se marcan con \x02 y \x03; el handler escapa el
+-- HTML del body y despues los cambia por <mark></mark>.
+SELECT
+  c.id, c.created_at, c.updated_at, c.body, c.user_id, c.parent_id,
+  ts_rank(c.search_vector, q.query)::real AS rank,
+  ts_headline('english', c.body, q.query, E'StartSel=\x02, StopSel=\x03, HighlightAll=true') AS headline
+FROM chirps c, websearch_to_tsquery('english', sqlc.arg(query)::text) AS q(query)
+WHERE c.search_vector @@ q.query
+  AND c.hidden_at IS NULL
+  AND (
+    sqlc.narg(after_rank)::real IS NULL
+    OR (ts_rank(c.search_vector, q.query), c.created_at, c.id) < (sqlc.narg(after_rank)::real, sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_id)::uuid)
+  )
+ORDER BY rank DESC, c.created_at DESC, c.id DESC
+LIMIT sqlc.arg(page_limit);
@@ -0,0 +1,22 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followed_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1
+AND   followed_id = $2;
+
+-- name: GetTimeline :many
+SELECT chirps.*
+FROM chirps
+JOIN follows ON follows.followed_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg(follower_id)
+  AND chirps.hidden_at IS NULL
+  AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_limit);
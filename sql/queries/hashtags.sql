@@ -0,0 +1,34 @@
+-- name: AddChirpHashtags :exec
+INSERT INTO chirp_hashtags (chirp_id, tag, created_at)
+SELECT sqlc.arg(chirp_id), unnest(sqlc.arg(tags)::text[]), NOW()
+ON CONFLICT DO NOTHING;
+
+-- name: GetChirpsByHashtag :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg(tag)
+  AND chirps.hidden_at IS NULL
+  AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetTrendingHashtags :many
+-- Cada uso pesa 2^(-edad/half_life), asi los usos recientes cuentan mas.
+SELECT
+  tag,
+  COUNT(*) AS uses,
+  SUM(POWER(2, -EXTRACT(EPOCH FROM (NOW() - created_at)) / sqlc.arg(half_life_seconds)::float8))::float8 AS score
+FROM chirp_hashtags
+WHERE created_at > NOW() - make_interval(secs => sqlc.arg(window_seconds)::float8)
+  AND NOT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE chirps.id = chirp_hashtags.chirp_id
+    AND   chirps.hidden_at IS NOT NULL
+  )
+GROUP BY tag
+ORDER BY score DESC, tag ASC
+LIMIT sqlc.arg(max_tags);
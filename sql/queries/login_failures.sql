@@ -0,0 +1,28 @@
+-- name: RecordLoginFailure :one
+-- Suma un fallo; si el anterior fue hace mas de la ventana se empieza de cero.
+INSERT INTO login_failures (key, failures, last_failure_at)
+VALUES (sqlc.arg(key), 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+      WHEN login_failures.last_failure_at < NOW() - make_interval(secs => sqlc.arg(window_seconds)::float8) THEN 1
+      ELSE login_failures.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING failures;
+
+-- name: LockLogin :exec
+-- El vencimiento lo calcula la DB, igual que el NOW() con el que se compara.
+UPDATE login_failures
+SET locked_until = NOW() + make_interval(secs => sqlc.arg(lock_seconds)::float8)
+WHERE key = sqlc.arg(key);
+
+-- name: GetLoginLocks :many
+-- Bloqueos vigentes y cuantos segundos les quedan.
+SELECT key, EXTRACT(EPOCH FROM locked_until - NOW())::float8 AS retry_after_seconds
+FROM login_failures
+WHERE key = ANY(sqlc.arg(keys)::text[])
+AND   locked_until > NOW();
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = ANY(sqlc.arg(keys)::text[]);
@@ -0,0 +1,20 @@
+-- name: AddChirpMentions :exec
+-- Los handles que no existen se ignoran.
+INSERT INTO mentions (chirp_id, user_id, created_at)
+SELECT sqlc.arg(chirp_id), users.id, NOW()
+FROM users
+WHERE lower(users.handle) = ANY(sqlc.arg(handles)::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: GetMentions :many
+SELECT chirps.*
+FROM chirps
+JOIN mentions ON mentions.chirp_id = chirps.id
+WHERE mentions.user_id = sqlc.arg(user_id)
+  AND chirps.hidden_at IS NULL
+  AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_limit);
@@ -0,0 +1,16 @@
+-- name: ListModerationRules :many
+SELECT *
+FROM moderation_rules
+ORDER BY word;
+
+-- name: UpsertModerationRule :one
+INSERT INTO moderation_rules (word, action, created_at, updated_at)
+VALUES ($1, $2, NOW(), NOW())
+ON CONFLICT (word) DO UPDATE
+SET action = EXCLUDED.action,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteModerationRule :execrows
+DELETE FROM moderation_rules
+WHERE word = $1;
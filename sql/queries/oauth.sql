@@ -0,0 +1,110 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListUserOAuthClients :many
+SELECT *
+FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1
+AND   owner_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, client_id, user_id, grant_id, redirect_uri, redirect_uri_sent, scopes, code_challenge, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), $9);
+
+-- name: ConsumeOAuthCode :one
+-- Marca el codigo como usado; sin filas si no existe, vencio o ya se uso.
+UPDATE oauth_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+AND   used_at IS NULL
+AND   expires_at > NOW()
+RETURNING *;
+
+-- name: GetOAuthCode :one
+SELECT *
+FROM oauth_codes
+WHERE code_hash = $1;
+
+-- name: CreateOAuthToken :exec
+INSERT INTO oauth_tokens (token_hash, grant_id, client_id, user_id, scopes, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, NOW(), $6);
+
+-- name: GetOAuthToken :one
+SELECT *
+FROM oauth_tokens
+WHERE token_hash = $1;
+
+-- name: ClaimOAuthToken :one
+UPDATE oauth_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1
+AND   revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_tokens
+SET revoked_at = NOW()
+WHERE grant_id = $1
+AND   revoked_at IS NULL;
+
+-- name: RevokeUserOAuthGrant :execrows
+UPDATE oauth_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+AND   grant_id = $2
+AND   revoked_at IS NULL;
+
+-- name: RevokeUserOAuthGrants :exec
+-- Corta todas las apps autorizadas, incluidos los codigos sin canjear.
+WITH codes AS (
+  UPDATE oauth_codes
+  SET used_at = NOW()
+  WHERE user_id = $1
+  AND   used_at IS NULL
+)
+UPDATE oauth_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+AND   revoked_at IS NULL;
+
+-- name: IsOAuthGrantActive :one
+-- Una autorizacion sigue viva mientras tenga un refresh token vigente y la
+-- cuenta no este suspendida.
+SELECT EXISTS (
+  SELECT 1
+  FROM oauth_tokens
+  JOIN users ON users.id = oauth_tokens.user_id
+  WHERE oauth_tokens.grant_id = $1
+  AND   oauth_tokens.revoked_at IS NULL
+  AND   oauth_tokens.expires_at > NOW()
+  AND   users.suspended_at IS NULL
+);
+
+-- name: ListUserOAuthGrants :many
+-- Las apps que el usuario autorizo: una fila por autorizacion activa, con el
+-- token vigente y cuando se dio el consentimiento.
+SELECT
+  t.grant_id,
+  t.client_id,
+  c.name AS client_name,
+  t.scopes,
+  (SELECT MIN(f.created_at) FROM oauth_tokens f WHERE f.grant_id = t.grant_id)::timestamp AS authorized_at,
+  t.created_at AS last_used_at
+FROM oauth_tokens t
+JOIN oauth_clients c ON c.id = t.client_id
+WHERE t.user_id = $1
+AND   t.revoked_at IS NULL
+AND   t.expires_at > NOW()
+ORDER BY t.created_at DESC;
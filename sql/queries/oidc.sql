@@ -0,0 +1,59 @@
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins (state_hash, provider, nonce, code_verifier, created_at, expires_at)
+VALUES ($1, $2, $3, $4, NOW(), $5);
+
+-- name: ConsumeOIDCLogin :one
+-- Cada state sirve una sola vez; sin filas si no existe o vencio.
+DELETE FROM oidc_logins
+WHERE state_hash = $1
+AND   expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLogins :exec
+-- Borra los logins en curso y los codigos de login que ya vencieron.
+WITH codes AS (
+  DELETE FROM oidc_login_codes
+  WHERE expires_at <= NOW()
+)
+DELETE FROM oidc_logins
+WHERE expires_at <= NOW();
+
+-- name: CreateOIDCLoginCode :exec
+INSERT INTO oidc_login_codes (code_hash, user_id, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3);
+
+-- name: ConsumeOIDCLoginCode :one
+-- Cada codigo sirve una sola vez; sin filas si no existe o vencio.
+WITH code AS (
+  DELETE FROM oidc_login_codes
+  WHERE code_hash = $1
+  AND   expires_at > NOW()
+  RETURNING user_id
+)
+SELECT users.*
+FROM users
+JOIN code ON code.user_id = users.id;
+
+-- name: LoginUserIdentity :one
+-- Marca el login con la identidad (y el email que trae hoy) y devuelve su usuario.
+WITH identity AS (
+  UPDATE user_identities
+  SET last_login_at = NOW(),
+      email = $3
+  WHERE issuer = $1
+  AND   subject = $2
+  RETURNING user_id
+)
+SELECT users.*
+FROM users
+JOIN identity ON identity.user_id = users.id;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW());
+
+-- name: MarkUserEmailVerified :exec
+UPDATE users
+SET verified_at = COALESCE(verified_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,48 @@
+-- name: CreateReport :one
+-- Un usuario solo puede tener un reporte pendiente por chirp: si ya lo tiene
+-- no devuelve filas.
+INSERT INTO reports (id, chirp_id, reporter_id, reason, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+ON CONFLICT (chirp_id, reporter_id) WHERE resolved_at IS NULL DO NOTHING
+RETURNING *;
+
+-- name: ListPendingReports :many
+-- La cola: un item por chirp con reportes pendientes, los mas viejos primero.
+SELECT
+  chirps.id AS chirp_id,
+  chirps.body,
+  chirps.user_id,
+  chirps.hidden_at,
+  COUNT(*) AS report_count,
+  array_agg(reports.reason ORDER BY reports.created_at)::text[] AS reasons,
+  MIN(reports.created_at)::timestamp AS first_reported_at
+FROM reports
+JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.resolved_at IS NULL
+GROUP BY chirps.id
+ORDER BY first_reported_at ASC, chirps.id ASC
+LIMIT $1;
+
+-- name: ResolveReports :execrows
+UPDATE reports
+SET resolved_at = NOW(),
+    decision_id = $2
+WHERE chirp_id = $1
+AND   resolved_at IS NULL;
+
+-- name: CreateModerationDecision :one
+INSERT INTO moderation_decisions (id, chirp_id, user_id, action, note, decided_by, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW())
+RETURNING *;
+
+-- name: ListModerationDecisions :many
+SELECT *
+FROM moderation_decisions
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = COALESCE(hidden_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1;
@@ -1,6 +1,6 @@
 -- name: CreateToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-VALUES ($1, NOW(), NOW(), $2, $3, NULL)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, last_used_at, user_agent, ip)
+VALUES ($1, NOW(), NOW(), $2, $3, NULL, $4, NOW(), $5, $6)
 RETURNING *;
 --
 
@@ -10,17 +10,63 @@ SELECT
   users.created_at,
   users.updated_at,
   users.email,
-  refresh_tokens.token,
+  refresh_tokens.token_hash,
   refresh_tokens.expires_at,
   refresh_tokens.revoked_at
 FROM refresh_tokens
 JOIN users ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 AND   refresh_tokens.revoked_at IS NULL
 AND   refresh_tokens.expires_at > NOW();
 ---
 
+-- name: ListUserSessions :many
+-- Una fila por familia activa: el token vigente y cuando empezo el login.
+SELECT
+  t.family_id,
+  (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id)::timestamp AS created_at,
+  t.last_used_at,
+  t.user_agent,
+  t.ip,
+  t.expires_at
+FROM refresh_tokens t
+WHERE t.user_id = $1
+AND   t.revoked_at IS NULL
+AND   t.expires_at > NOW()
+ORDER BY t.last_used_at DESC;
+
 -- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: GetRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = $1;
+
+-- name: ClaimRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
+AND   revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND   revoked_at IS NULL;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND   family_id = $2
+AND   revoked_at IS NULL;
+
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND   revoked_at IS NULL;
@@ -0,0 +1,64 @@
+-- name: GetUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: StartTOTPEnrollment :execrows
+-- Pisa un enrolamiento sin confirmar; si el 2FA ya esta activo no toca nada.
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+    created_at = NOW(),
+    last_step = 0
+WHERE user_totp.confirmed_at IS NULL;
+
+-- name: ConfirmTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(),
+    last_step = $2
+WHERE user_id = $1
+AND   confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+-- Solo avanza: un paso igual o anterior es un codigo repetido.
+UPDATE user_totp
+SET last_step = $2
+WHERE user_id = $1
+AND   confirmed_at IS NOT NULL
+AND   last_step < $2;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (code_hash, user_id, created_at)
+SELECT unnest(sqlc.arg(code_hashes)::text[]), sqlc.arg(user_id)::uuid, NOW();
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+AND   code_hash = $2
+AND   used_at IS NULL;
+
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3);
+
+-- name: ClaimLoginChallengeAttempt :one
+-- Cuenta el intento antes de ver el codigo; despues de 5 el challenge no sirve mas.
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1
+AND   used_at IS NULL
+AND   expires_at > NOW()
+AND   attempts < 5
+RETURNING user_id;
+
+-- name: ConsumeLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1
+AND   used_at IS NULL;
@@ -10,9 +10,80 @@ WHERE email = $1;
 --
 
 -- name: UpdateUser :one
+-- Si handle es NULL se deja el actual; un string vacio lo borra.
+-- Cambiar el email obliga a verificarlo de nuevo.
 UPDATE users
-SET email = $2,
-    hashed_password = $3,
+SET email = sqlc.arg(email),
+    hashed_password = sqlc.arg(hashed_password),
+    handle = NULLIF(COALESCE(sqlc.narg(handle), handle), ''),
+    verified_at = CASE WHEN email = sqlc.arg(email) THEN verified_at END,
     updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, suspended_at, role, verified_at;
+
+-- name: SetUserHandle :one
+-- Un string vacio borra el handle.
+UPDATE users
+SET handle = NULLIF($2, ''),
+    updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password;
\ No newline at end of file
+RETURNING *;
+
+-- name: UpgradeUserToChirpyRed :one
+UPDATE users
+SET is_chirpy_red = TRUE,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserAccess :one
+-- Rol y suspension vigentes: requireRole no confia en el rol del token, asi
+-- un cambio de rol se aplica en el proximo request.
+SELECT role, suspended_at IS NOT NULL AS suspended
+FROM users
+WHERE id = $1;
+
+-- name: UnsuspendUser :exec
+UPDATE users
+SET suspended_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: IsUserSuspended :one
+-- Se chequea en cada request autenticado; sql.ErrNoRows si la cuenta no existe.
+SELECT suspended_at IS NOT NULL AS suspended
+FROM users
+WHERE id = $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: PromoteAdmin :one
+-- Para el primer admin (-promote-admin). Solo cuentas con el email verificado.
+UPDATE users
+SET role = 'admin',
+    updated_at = NOW()
+WHERE email = $1
+AND   verified_at IS NOT NULL
+RETURNING *;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,22 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4);
+
+-- name: VerifyUserEmail :one
+-- Consume el token (una sola vez, sin vencer) y marca el email como verificado.
+-- Un token emitido para otro email ya no verifica nada.
+WITH claimed AS (
+  UPDATE email_verification_tokens
+  SET used_at = NOW()
+  WHERE token_hash = $1
+  AND   used_at IS NULL
+  AND   expires_at > NOW()
+  RETURNING user_id, email
+)
+UPDATE users
+SET verified_at = COALESCE(users.verified_at, NOW()),
+    updated_at = NOW()
+FROM claimed
+WHERE users.id = claimed.user_id
+AND   users.email = claimed.email
+RETURNING users.*;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Sin FK a proposito: si se borra el chirp padre las respuestas no se borran
+-- en cascada, quedan como huerfanas apuntando a un id que ya no existe.
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID;
+
+CREATE INDEX chirps_parent_id_idx ON chirps (parent_id);
+
+-- +goose Down
+DROP INDEX chirps_parent_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN parent_id;
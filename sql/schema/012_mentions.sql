@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN handle TEXT;
+
+-- Los handles no distinguen mayusculas: @Ana y @ana son la misma cuenta
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (lower(handle));
+
+CREATE TABLE mentions (
+    chirp_id   UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE INDEX mentions_user_id_created_at_idx ON mentions (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE mentions;
+DROP INDEX users_handle_lower_idx;
+ALTER TABLE users DROP COLUMN handle;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE moderation_rules (
+    word       TEXT PRIMARY KEY,
+    action     TEXT NOT NULL CHECK (action IN ('mask', 'flag', 'reject')),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Las palabras que cleanChirp tenia fijas en el codigo
+INSERT INTO moderation_rules (word, action, created_at, updated_at) VALUES
+    ('kerfuffle', 'mask', NOW(), NOW()),
+    ('sharbert', 'mask', NOW(), NOW()),
+    ('fornax', 'mask', NOW(), NOW());
+
+-- Chirps publicados que matchearon una regla flag, pendientes de revision
+CREATE TABLE moderation_flags (
+    chirp_id   UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+    words      TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX moderation_flags_created_at_idx ON moderation_flags (created_at DESC);
+
+-- +goose Down
+DROP TABLE moderation_flags;
+DROP TABLE moderation_rules;
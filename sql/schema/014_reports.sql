@@ -0,0 +1,52 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+
+-- Cada decision de un moderador queda registrada, aunque despues se borre el
+-- chirp (por eso chirp_id no tiene FK).
+CREATE TABLE moderation_decisions (
+    id         UUID PRIMARY KEY,
+    chirp_id   UUID NOT NULL,
+    user_id    UUID NOT NULL,
+    action     TEXT NOT NULL CHECK (action IN ('hide', 'dismiss', 'suspend')),
+    note       TEXT NOT NULL DEFAULT '',
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX moderation_decisions_created_at_idx ON moderation_decisions (created_at DESC);
+
+-- reporter_id NULL es un reporte automatico (regla flag de la wordlist)
+CREATE TABLE reports (
+    id          UUID PRIMARY KEY,
+    chirp_id    UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    reporter_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    reason      TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    decision_id UUID REFERENCES moderation_decisions(id)
+);
+
+CREATE UNIQUE INDEX reports_pending_reporter_idx ON reports (chirp_id, reporter_id) WHERE resolved_at IS NULL;
+CREATE INDEX reports_pending_created_at_idx ON reports (created_at) WHERE resolved_at IS NULL;
+
+-- Los chirps marcados por la wordlist pasan a la cola como reportes automaticos
+INSERT INTO reports (id, chirp_id, reporter_id, reason, created_at)
+SELECT gen_random_uuid(), chirp_id, NULL, 'flagged words: ' || array_to_string(words, ', '), created_at
+FROM moderation_flags;
+
+DROP TABLE moderation_flags;
+
+-- +goose Down
+CREATE TABLE moderation_flags (
+    chirp_id   UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+    words      TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX moderation_flags_created_at_idx ON moderation_flags (created_at DESC);
+
+DROP TABLE reports;
+DROP TABLE moderation_decisions;
+ALTER TABLE users DROP COLUMN suspended_at;
+ALTER TABLE chirps DROP COLUMN hidden_at;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMP;
+
+-- Las cuentas que ya existen se dan por verificadas
+UPDATE users SET verified_at = created_at;
+
+-- Solo se guarda el SHA-256 del token que va en el mail
+CREATE TABLE email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email      TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at    TIMESTAMP
+);
+
+CREATE INDEX email_verification_tokens_user_idx ON email_verification_tokens (user_id);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users DROP COLUMN verified_at;
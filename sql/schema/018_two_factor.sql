@@ -0,0 +1,34 @@
+-- +goose Up
+-- Un secreto por usuario; hasta que se confirma con un codigo el 2FA no esta activo
+CREATE TABLE user_totp (
+    user_id      UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret       TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP,
+    -- ultimo paso de 30s aceptado, para que un codigo no sirva dos veces
+    last_step    BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes (
+    code_hash  TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    used_at    TIMESTAMP
+);
+
+CREATE INDEX recovery_codes_user_idx ON recovery_codes (user_id);
+
+-- El token intermedio que devuelve el login cuando falta el segundo factor
+CREATE TABLE login_challenges (
+    token_hash TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    attempts   INT NOT NULL DEFAULT 0,
+    used_at    TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
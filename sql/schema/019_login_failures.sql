@@ -0,0 +1,12 @@
+-- +goose Up
+-- Fallos de login por clave ("email:..." o "ip:..."). En la DB para que
+-- sobreviva a un reinicio y lo compartan todas las instancias.
+CREATE TABLE login_failures (
+    key             TEXT PRIMARY KEY,
+    failures        INT NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until    TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_failures;
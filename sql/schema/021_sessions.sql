@@ -0,0 +1,19 @@
+-- +goose Up
+-- Datos de la sesion (familia) para /api/sessions. Cada token guarda el
+-- dispositivo que lo pidio; last_used_at es el ultimo login o refresh.
+ALTER TABLE refresh_tokens
+ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+UPDATE refresh_tokens SET last_used_at = updated_at;
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN ip,
+DROP COLUMN user_agent,
+DROP COLUMN last_used_at;
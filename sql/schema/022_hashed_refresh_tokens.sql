@@ -0,0 +1,16 @@
+-- +goose Up
+-- refresh_tokens guarda el SHA-256 (hex) del token, como los demas tokens
+-- opacos. Los que ya existen se rehashean aca: el cliente sigue mandando el
+-- mismo token, su hash coincide y nadie pierde la sesion.
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- Un hash no se puede volver atras: se cierran todas las sesiones
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
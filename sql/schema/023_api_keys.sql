@@ -0,0 +1,21 @@
+-- +goose Up
+-- API keys personales para bots e integraciones. Como los demas tokens
+-- opacos se guarda solo el SHA-256; hint es el comienzo de la key para que el
+-- usuario la reconozca en la lista.
+CREATE TABLE api_keys (
+    id           UUID PRIMARY KEY,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    key_hash     TEXT NOT NULL UNIQUE,
+    hint         TEXT NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    expires_at   TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
@@ -0,0 +1,48 @@
+-- +goose Up
+-- Clientes OAuth registrados por los usuarios. secret_hash NULL es un cliente
+-- publico (una app movil o SPA): se autentica solo con PKCE.
+CREATE TABLE oauth_clients (
+    id            UUID PRIMARY KEY,
+    owner_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    secret_hash   TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    created_at    TIMESTAMP NOT NULL
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients (owner_id);
+
+-- Codigos de autorizacion, de un solo uso. grant_id se elige al crear el
+-- codigo, asi si el codigo se reusa se pueden revocar los tokens que dio.
+CREATE TABLE oauth_codes (
+    code_hash      TEXT PRIMARY KEY,
+    client_id      UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id        UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    grant_id       UUID NOT NULL,
+    redirect_uri   TEXT NOT NULL,
+    scopes         TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at     TIMESTAMP NOT NULL,
+    expires_at     TIMESTAMP NOT NULL,
+    used_at        TIMESTAMP
+);
+
+-- Refresh tokens de los clientes. Rotan como los de login; grant_id agrupa
+-- los de una misma autorizacion.
+CREATE TABLE oauth_tokens (
+    token_hash TEXT PRIMARY KEY,
+    grant_id   UUID NOT NULL,
+    client_id  UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scopes     TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX oauth_tokens_grant_id_idx ON oauth_tokens (grant_id);
+
+-- +goose Down
+DROP TABLE oauth_tokens;
+DROP TABLE oauth_codes;
+DROP TABLE oauth_clients;
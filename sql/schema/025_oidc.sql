@@ -0,0 +1,31 @@
+-- +goose Up
+-- Cuentas de proveedores OpenID Connect vinculadas a un usuario. La identidad
+-- es (issuer, subject): el email del proveedor puede cambiar y no se usa para
+-- buscar, solo queda como referencia del ultimo login.
+CREATE TABLE user_identities (
+    id            UUID PRIMARY KEY,
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer        TEXT NOT NULL,
+    subject       TEXT NOT NULL,
+    email         TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- Logins en curso: entre el redirect al proveedor y el callback. Se guarda el
+-- hash del state; el state en si va en una cookie del navegador.
+CREATE TABLE oidc_logins (
+    state_hash    TEXT PRIMARY KEY,
+    provider      TEXT NOT NULL,
+    nonce         TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    expires_at    TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_logins;
+DROP TABLE user_identities;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- /api/oauth/grants lista y revoca las autorizaciones por usuario, y cerrar
+-- todas las sesiones tambien corta los codigos y tokens de las apps.
+CREATE INDEX oauth_tokens_user_id_idx ON oauth_tokens (user_id) WHERE revoked_at IS NULL;
+CREATE INDEX oauth_codes_user_id_idx ON oauth_codes (user_id) WHERE used_at IS NULL;
+
+-- +goose Down
+DROP INDEX oauth_codes_user_id_idx;
+DROP INDEX oauth_tokens_user_id_idx;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Codigos de un solo uso con los que el frontend canjea un login OIDC por
+-- los tokens: el callback redirige al frontend con el codigo y no con los
+-- tokens, que quedarian en el historial y los logs. Se guarda el hash.
+CREATE TABLE oidc_login_codes (
+    code_hash  TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_login_codes;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Si el authorize trajo redirect_uri, el canje lo tiene que repetir igual
+-- (RFC 6749 4.1.3); si se omitio porque el cliente registro uno solo, el
+-- canje tambien lo puede omitir.
+ALTER TABLE oauth_codes ADD COLUMN redirect_uri_sent BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE oauth_codes DROP COLUMN redirect_uri_sent;
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+	maxAncestorDepth   = 50
+	maxThreadReplies   = 500
+)
+
+type threadNode struct {
+	chirpResponse
+	Replies []*threadNode `json:"replies"`
+}
+
+type threadResponse struct {
+	// Del chirp raiz hasta el padre directo
+	Ancestors []chirpResponse `json:"ancestors"`
+	Chirp     *threadNode     `json:"chirp"`
+	// true si el hilo tenia mas respuestas que maxThreadReplies
+	Truncated bool `json:"truncated"`
+}
+
+// GET /api/chirps/{chirpID}/thread?depth=N
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirpID")
+		return
+	}
+
+	depth := defaultThreadDepth
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		depth, err = strconv.Atoi(raw)
+		if err != nil || depth < 0 || depth > maxThreadDepth {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("depth must be an integer between 0 and %d", maxThreadDepth))
+			return
+		}
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "chirp not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get chirp")
+		return
+	}
+	if dbChirp.HiddenAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	ancestors, err := cfg.db.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ID:       chirpID,
+		MaxDepth: maxAncestorDepth,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get thread")
+		return
+	}
+
+	var descendants []database.GetChirpDescendantsRow
+	if depth > 0 {
+		// Pedimos una fila extra para saber si el hilo quedo cortado
+		descendants, err = cfg.db.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+			ID:       chirpID,
+			MaxDepth: int32(depth),
+			MaxRows:  maxThreadReplies + 1,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not get thread")
+			return
+		}
+	}
+
+	res := threadResponse{}
+	if len(descendants) > maxThreadReplies {
+		descendants = descendants[:maxThreadReplies]
+		res.Truncated = true
+	}
+
+	// Todos los chirps del hilo en una lista para sacar los contadores de una vez
+	all := make([]database.Chirp, 0, 1+len(ancestors)+len(descendants))
+	all = append(all, dbChirp)
+	for _, a := range ancestors {
+		all = append(all, database.Chirp{ID: a.ID, CreatedAt: a.CreatedAt, UpdatedAt: a.UpdatedAt, Body: a.Body, UserID: a.UserID, ParentID: a.ParentID})
+	}
+	for _, d := range descendants {
+		all = append(all, database.Chirp{ID: d.ID, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt, Body: d.Body, UserID: d.UserID, ParentID: d.ParentID})
+	}
+
+	responses, err := cfg.chirpResponses(r.Context(), all, cfg.viewerID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get thread")
+		return
+	}
+
+	res.Chirp = &threadNode{chirpResponse: responses[0], Replies: []*threadNode{}}
+	res.Ancestors = responses[1 : 1+len(ancestors)]
+
+	// Los descendientes vienen ordenados por profundidad, asi que el padre
+	// de cada uno ya esta en el mapa cuando lo procesamos.
+	nodes := map[uuid.UUID]*threadNode{chirpID: res.Chirp}
+	for _, resp := range responses[1+len(ancestors):] {
+		node := &threadNode{chirpResponse: resp, Replies: []*threadNode{}}
+		nodes[resp.ID] = node
+		if parent, ok := nodes[*resp.ParentID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+func threadRow(c database.Chirp, depth int32) []driver.Value {
+	return []driver.Value{c.ID.String(), c.CreatedAt, c.UpdatedAt, c.Body, c.UserID.String(), nullUUID(c.ParentID), int64(depth)}
+}
+
+func TestHandlerGetChirpThread(t *testing.T) {
+	now := time.Now().UTC()
+	chirp := func(parent *database.Chirp) database.Chirp {
+		c := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "c", UserID: uuid.New()}
+		if parent != nil {
+			c.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+		return c
+	}
+
+	root := chirp(nil)
+	target := chirp(&root)
+	reply := chirp(&target)
+	nested := chirp(&reply)
+	sibling := chirp(&target)
+
+	cfg, f := newTestConfig(t)
+	f.returns("GetChirp", chirpRow(target))
+	f.returns("GetChirpAncestors", threadRow(root, 1))
+	f.returns("GetChirpDescendants", threadRow(reply, 1), threadRow(sibling, 1), threadRow(nested, 2))
+	f.returns("GetChirpStats",
+		[]driver.Value{target.ID.String(), int64(2), int64(0), false},
+		[]driver.Value{reply.ID.String(), int64(1), int64(0), false},
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+target.ID.String()+"/thread?depth=2", nil)
+	req.SetPathValue("chirpID", target.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerGetChirpThread(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	var res threadResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Ancestors) != 1 || res.Ancestors[0].ID != root.ID {
+		t.Fatalf("ancestors = %+v, want the root chirp", res.Ancestors)
+	}
+	if res.Chirp.ID != target.ID || res.Chirp.ReplyCount != 2 || *res.Chirp.ParentID != root.ID {
+		t.Errorf("unexpected chirp %+v", res.Chirp.chirpResponse)
+	}
+	if len(res.Chirp.Replies) != 2 || res.Chirp.Replies[0].ID != reply.ID || res.Chirp.Replies[1].ID != sibling.ID {
+		t.Fatalf("unexpected replies %+v", res.Chirp.Replies)
+	}
+	if r := res.Chirp.Replies[0]; r.ReplyCount != 1 || len(r.Replies) != 1 || r.Replies[0].ID != nested.ID {
+		t.Errorf("nested reply missing: %+v", r)
+	}
+	if got := f.called("GetChirpDescendants")[0][1]; got != int64(2) {
+		t.Errorf("max_depth arg = %v, want 2", got)
+	}
+}
+
+func TestHandlerGetChirpThreadErrors(t *testing.T) {
+	now := time.Now().UTC()
+	visible := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "c", UserID: uuid.New()}
+	hidden := visible
+	hidden.HiddenAt = sql.NullTime{Time: now, Valid: true}
+
+	tests := []struct {
+		name       string
+		chirpID    string
+		query      string
+		chirp      *database.Chirp
+		wantStatus int
+	}{
+		{name: "invalid id", chirpID: "nope", wantStatus: http.StatusBadRequest},
+		{name: "unknown chirp", chirpID: visible.ID.String(), wantStatus: http.StatusNotFound},
+		{name: "hidden chirp", chirpID: visible.ID.String(), chirp: &hidden, wantStatus: http.StatusNotFound},
+		{name: "depth not a number", chirpID: visible.ID.String(), query: "depth=deep", chirp: &visible, wantStatus: http.StatusBadRequest},
+		{name: "negative depth", chirpID: visible.ID.String(), query: "depth=-1", chirp: &visible, wantStatus: http.StatusBadRequest},
+		{name: "depth over the limit", chirpID: visible.ID.String(), query: fmt.Sprintf("depth=%d", maxThreadDepth+1), chirp: &visible, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.chirp != nil {
+				f.returns("GetChirp", chirpRow(*tc.chirp))
+			} else {
+				f.returns("GetChirp")
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+tc.chirpID+"/thread?"+tc.query, nil)
+			req.SetPathValue("chirpID", tc.chirpID)
+			rec := httptest.NewRecorder()
+			cfg.handlerGetChirpThread(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if n := len(f.called("GetChirpDescendants")); n != 0 {
+				t.Errorf("GetChirpDescendants called %d times", n)
+			}
+		})
+	}
+}
+
+// getThread pide el hilo de chirp y decodifica la respuesta.
+func getThread(t *testing.T, cfg *apiConfig, chirpID uuid.UUID, query string) threadResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirpID.String()+"/thread?"+query, nil)
+	req.SetPathValue("chirpID", chirpID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerGetChirpThread(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	var res threadResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestHandlerGetChirpThreadLimits(t *testing.T) {
+	now := time.Now().UTC()
+	root := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "root", UserID: uuid.New()}
+	reply := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "reply", UserID: uuid.New(), ParentID: uuid.NullUUID{UUID: root.ID, Valid: true}}
+
+	t.Run("depth 0 skips replies", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetChirp", chirpRow(root))
+		f.returns("GetChirpAncestors")
+		f.returns("GetChirpStats", []driver.Value{root.ID.String(), int64(1), int64(0), false})
+
+		res := getThread(t, cfg, root.ID, "depth=0")
+		if len(res.Chirp.Replies) != 0 || res.Chirp.ReplyCount != 1 || res.Truncated {
+			t.Errorf("chirp = %+v", res.Chirp)
+		}
+		if n := len(f.called("GetChirpDescendants")); n != 0 {
+			t.Errorf("GetChirpDescendants called %d times", n)
+		}
+	})
+
+	// En el limite de profundidad las respuestas no vienen, pero reply_count
+	// dice que hay mas para pedir
+	t.Run("cut at the depth limit", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetChirp", chirpRow(root))
+		f.returns("GetChirpAncestors")
+		f.returns("GetChirpDescendants", threadRow(reply, 1))
+		f.returns("GetChirpStats",
+			[]driver.Value{root.ID.String(), int64(1), int64(0), false},
+			[]driver.Value{reply.ID.String(), int64(4), int64(0), false},
+		)
+
+		res := getThread(t, cfg, root.ID, "depth=1")
+		if len(res.Chirp.Replies) != 1 {
+			t.Fatalf("replies = %+v", res.Chirp.Replies)
+		}
+		if r := res.Chirp.Replies[0]; r.ID != reply.ID || r.ReplyCount != 4 || len(r.Replies) != 0 {
+			t.Errorf("reply = %+v", r)
+		}
+		if got := f.called("GetChirpDescendants")[0][1]; got != int64(1) {
+			t.Errorf("max_depth arg = %v, want 1", got)
+		}
+	})
+
+	t.Run("too many replies", func(t *testing.T) {
+		cfg, f := newTestConfig(t)
+		f.returns("GetChirp", chirpRow(root))
+		f.returns("GetChirpAncestors")
+		rows := make([][]driver.Value, 0, maxThreadReplies+1)
+		for range maxThreadReplies + 1 {
+			c := reply
+			c.ID = uuid.New()
+			rows = append(rows, threadRow(c, 1))
+		}
+		f.returns("GetChirpDescendants", rows...)
+		f.returns("GetChirpStats")
+
+		res := getThread(t, cfg, root.ID, "")
+		if !res.Truncated || len(res.Chirp.Replies) != maxThreadReplies {
+			t.Errorf("truncated = %v with %d replies", res.Truncated, len(res.Chirp.Replies))
+		}
+		if got := f.called("GetChirpDescendants")[0][2]; got != int64(maxThreadReplies+1) {
+			t.Errorf("max_rows arg = %v, want %d", got, maxThreadReplies+1)
+		}
+	})
+}
+
+// Borrar el padre no borra las respuestas: quedan como huerfanas, con el
+// parent_id original y sin ancestros.
+func TestHandlerGetChirpThreadOrphan(t *testing.T) {
+	now := time.Now().UTC()
+	deletedParent := uuid.New()
+	orphan := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "orphan", UserID: uuid.New(), ParentID: uuid.NullUUID{UUID: deletedParent, Valid: true}}
+
+	cfg, f := newTestConfig(t)
+	f.returns("GetChirp", chirpRow(orphan))
+	f.returns("GetChirpAncestors")
+	f.returns("GetChirpDescendants")
+	f.returns("GetChirpStats")
+
+	res := getThread(t, cfg, orphan.ID, "")
+	if len(res.Ancestors) != 0 {
+		t.Errorf("ancestors = %+v, want none", res.Ancestors)
+	}
+	if res.Chirp.ID != orphan.ID || res.Chirp.ParentID == nil || *res.Chirp.ParentID != deletedParent {
+		t.Errorf("chirp = %+v", res.Chirp.chirpResponse)
+	}
+	if res.Chirp.Replies == nil {
+		t.Error("replies = null, want []")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+	loginChallengeTTL = 5 * time.Minute
+)
+
+var errInvalidSecondFactor = errors.New("invalid second factor")
+
+type twoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type loginChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// createLoginChallenge guarda el hash de un token opaco que solo sirve para
+// /api/login/2fa. No es un JWT para que no se pueda usar como access token.
+func (cfg *apiConfig) createLoginChallenge(ctx context.Context, userID uuid.UUID) (loginChallengeResponse, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return loginChallengeResponse{}, err
+	}
+	expiresAt := time.Now().Add(loginChallengeTTL)
+	if err := cfg.db.CreateLoginChallenge(ctx, database.CreateLoginChallengeParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return loginChallengeResponse{}, err
+	}
+	return loginChallengeResponse{TwoFactorRequired: true, ChallengeToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// POST /api/users/2fa/enroll: genera un secreto nuevo. El 2FA no queda
+// activo hasta confirmarlo con un codigo.
+func (cfg *apiConfig) handlerTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get user")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create secret")
+		return
+	}
+
+	n, err := cfg.db.StartTOTPEnrollment(r.Context(), database.StartTOTPEnrollmentParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not start enrollment")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusConflict, "2fa already enabled")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, twoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, dbUser.Email, secret),
+	})
+}
+
+// POST /api/users/2fa/confirm: activa el 2FA con el primer codigo y devuelve
+// los codigos de recuperacion (es la unica vez que se ven).
+func (cfg *apiConfig) handlerTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "2fa enrollment not started")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get 2fa")
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "2fa already enabled")
+		return
+	}
+
+	step, err := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create recovery codes")
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, auth.HashToken(auth.NormalizeRecoveryCode(c)))
+	}
+
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		n, err := q.ConfirmTOTP(r.Context(), database.ConfirmTOTPParams{UserID: userID, LastStep: step})
+		if err != nil {
+			return err
+		}
+		// Otro request lo confirmo primero
+		if n == 0 {
+			return errInvalidSecondFactor
+		}
+		if err := q.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+			return err
+		}
+		return q.CreateRecoveryCodes(r.Context(), database.CreateRecoveryCodesParams{CodeHashes: hashes, UserID: userID})
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			respondWithError(w, http.StatusConflict, "2fa already enabled")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not enable 2fa")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// POST /api/login/2fa: cambia el challenge del login mas un codigo TOTP (o un
+// codigo de recuperacion) por los tokens de verdad.
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req loginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.ChallengeToken == "" || (req.Code == "") == (req.RecoveryCode == "") {
+		respondWithError(w, http.StatusBadRequest, "challenge_token and either code or recovery_code required")
+		return
+	}
+
+	challengeHash := auth.HashToken(req.ChallengeToken)
+	userID, err := cfg.db.ClaimLoginChallengeAttempt(r.Context(), challengeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "invalid or expired challenge")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not check challenge")
+		return
+	}
+
+	if err := cfg.checkSecondFactor(r.Context(), userID, req); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			respondWithError(w, http.StatusUnauthorized, "invalid code")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not check code")
+		return
+	}
+
+	// Un challenge da un solo login aunque lleguen dos codigos validos juntos
+	n, err := cfg.db.ConsumeLoginChallenge(r.Context(), challengeHash)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not check challenge")
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get user")
+		return
+	}
+	if dbUser.SuspendedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "account suspended")
+		return
+	}
+
+	res, err := cfg.issueTokens(r, dbUser)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create tokens")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// checkSecondFactor valida el codigo TOTP o gasta un codigo de recuperacion.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, userID uuid.UUID, req loginTwoFactorRequest) error {
+	if req.RecoveryCode != "" {
+		n, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(req.RecoveryCode)),
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+	step, err := auth.ValidateTOTP(totp.Secret, strings.TrimSpace(req.Code), time.Now())
+	if err != nil {
+		return errInvalidSecondFactor
+	}
+	// Si el paso no avanza es un codigo que ya se uso
+	n, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: userID, LastStep: step})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
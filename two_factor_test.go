@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func totpRow(userID uuid.UUID, confirmed bool, lastStep int64) []driver.Value {
+	var confirmedAt driver.Value
+	if confirmed {
+		confirmedAt = time.Now()
+	}
+	return []driver.Value{userID.String(), testTOTPSecret, time.Now(), confirmedAt, lastStep}
+}
+
+// returnsNewToken hace que CreateToken devuelva el token que se le paso.
+func returnsNewToken(f *fakeDB, userID uuid.UUID) {
+	f.on("CreateToken", func(args []driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{refreshTokenRow(database.RefreshToken{
+			TokenHash: args[0].(string),
+			UserID:    userID,
+			ExpiresAt: args[2].(time.Time),
+			FamilyID:  uuid.New(),
+		})}, nil
+	})
+}
+
+func TestHandlerLoginTwoFactorChallenge(t *testing.T) {
+	hash, err := auth.HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := database.User{ID: uuid.New(), Email: "a@example.com", HashedPassword: hash}
+
+	tests := []struct {
+		name          string
+		totp          []driver.Value
+		wantChallenge bool
+	}{
+		{name: "2fa enabled", totp: totpRow(user.ID, true, 0), wantChallenge: true},
+		{name: "enrollment not confirmed", totp: totpRow(user.ID, false, 0)},
+		{name: "no 2fa"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("GetLoginLocks")
+			f.returns("ClearLoginFailures")
+			f.returns("GetUserEmail", userRow(user))
+			if tc.totp != nil {
+				f.returns("GetUserTOTP", tc.totp)
+			} else {
+				f.returns("GetUserTOTP")
+			}
+			f.returns("CreateLoginChallenge")
+			returnsNewToken(f, user.ID)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":"a@example.com","password":"pw"}`))
+			rec := httptest.NewRecorder()
+			cfg.handlerLogin(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+			}
+			var res map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.wantChallenge {
+				token, _ := res["token"].(string)
+				refresh, _ := res["refresh_token"].(string)
+				if token == "" || refresh == "" || len(f.called("CreateLoginChallenge")) != 0 {
+					t.Errorf("expected tokens without a challenge, got %v", res)
+				}
+				return
+			}
+			// Ni access ni refresh token hasta pasar el segundo factor
+			if _, ok := res["token"]; ok || len(f.called("CreateToken")) != 0 {
+				t.Errorf("tokens issued before 2fa: %v", res)
+			}
+			challenge, _ := res["challenge_token"].(string)
+			if res["two_factor_required"] != true || challenge == "" {
+				t.Fatalf("unexpected response %v", res)
+			}
+			if args := f.called("CreateLoginChallenge")[0]; args[0] != auth.HashToken(challenge) || args[1] != user.ID.String() {
+				t.Errorf("CreateLoginChallenge args = %v", args)
+			}
+			// El challenge no sirve como access token
+			if _, err := cfg.jwtKeys.ValidateJWT(challenge); err == nil {
+				t.Error("challenge token validated as a JWT")
+			}
+		})
+	}
+}
+
+func TestHandlerLoginTwoFactor(t *testing.T) {
+	userID := uuid.New()
+	code, err := auth.TOTPCode(testTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(f *fakeDB)
+		wantStatus int
+	}{
+		{
+			name:       "totp code",
+			body:       `{"challenge_token":"ch","code":"` + code + `"}`,
+			setup:      func(f *fakeDB) { f.returns("UseTOTPStep", nil) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "replayed code",
+			body:       `{"challenge_token":"ch","code":"` + code + `"}`,
+			setup:      func(f *fakeDB) { f.returns("UseTOTPStep") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong code",
+			body:       `{"challenge_token":"ch","code":"000000x"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "recovery code",
+			body:       `{"challenge_token":"ch","recovery_code":"ABCD-EFGH-IJKL-MNOP"}`,
+			setup:      func(f *fakeDB) { f.returns("UseRecoveryCode", nil) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "used recovery code",
+			body:       `{"challenge_token":"ch","recovery_code":"abcd-efgh-ijkl-mnop"}`,
+			setup:      func(f *fakeDB) { f.returns("UseRecoveryCode") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired challenge",
+			body:       `{"challenge_token":"ch","code":"` + code + `"}`,
+			setup:      func(f *fakeDB) { f.returns("ClaimLoginChallengeAttempt") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "code and recovery code",
+			body:       `{"challenge_token":"ch","code":"123456","recovery_code":"abcd"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("ClaimLoginChallengeAttempt", []driver.Value{userID.String()})
+			f.returns("GetUserTOTP", totpRow(userID, true, 0))
+			f.returns("ConsumeLoginChallenge", nil)
+			f.returns("GetUserByID", userRow(database.User{ID: userID, Email: "a@example.com"}))
+			returnsNewToken(f, userID)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/login/2fa", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			cfg.handlerLoginTwoFactor(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				if len(f.called("CreateToken")) != 0 || len(f.called("ConsumeLoginChallenge")) != 0 {
+					t.Error("tokens issued for a failed second factor")
+				}
+				return
+			}
+
+			if args := f.called("ClaimLoginChallengeAttempt")[0]; args[0] != auth.HashToken("ch") {
+				t.Errorf("challenge looked up by %v, want its hash", args[0])
+			}
+			if args := f.called("UseRecoveryCode"); len(args) == 1 && args[0][1] != auth.HashToken("abcdefghijklmnop") {
+				t.Errorf("UseRecoveryCode args = %v", args[0])
+			}
+			var res User
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || res.Token == "" || res.RefreshToken == "" {
+				t.Errorf("response = %+v (%v)", res, err)
+			}
+		})
+	}
+}
+
+func TestHandlerTwoFactorEnroll(t *testing.T) {
+	userID := uuid.New()
+
+	for _, tc := range []struct {
+		name       string
+		started    bool
+		wantStatus int
+	}{
+		{name: "starts", started: true, wantStatus: http.StatusOK},
+		{name: "already enabled", wantStatus: http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			f.returns("GetUserByID", userRow(database.User{ID: userID, Email: "a@example.com"}))
+			if tc.started {
+				f.returns("StartTOTPEnrollment", nil)
+			} else {
+				f.returns("StartTOTPEnrollment")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/2fa/enroll", nil)
+			req.Header.Set("Authorization", bearer(t, userID))
+			rec := httptest.NewRecorder()
+			cfg.handlerTwoFactorEnroll(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var res twoFactorEnrollResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if args := f.called("StartTOTPEnrollment")[0]; args[1] != res.Secret {
+				t.Errorf("stored secret %v, returned %v", args[1], res.Secret)
+			}
+			if !strings.HasPrefix(res.OTPAuthURI, "otpauth://totp/Chirpy:a@example.com?") {
+				t.Errorf("otpauth_uri = %s", res.OTPAuthURI)
+			}
+		})
+	}
+}
+
+func TestHandlerTwoFactorConfirm(t *testing.T) {
+	userID := uuid.New()
+	code, err := auth.TOTPCode(testTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		code       string
+		totp       []driver.Value
+		wantStatus int
+	}{
+		{name: "confirms", code: code, totp: totpRow(userID, false, 0), wantStatus: http.StatusOK},
+		{name: "wrong code", code: "12345x", totp: totpRow(userID, false, 0), wantStatus: http.StatusBadRequest},
+		{name: "already enabled", code: code, totp: totpRow(userID, true, 0), wantStatus: http.StatusConflict},
+		{name: "not enrolled", code: code, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.totp != nil {
+				f.returns("GetUserTOTP", tc.totp)
+			} else {
+				f.returns("GetUserTOTP")
+			}
+			f.returns("ConfirmTOTP", nil)
+			f.returns("DeleteRecoveryCodes")
+			f.returns("CreateRecoveryCodes")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/2fa/confirm", strings.NewReader(`{"code":"`+tc.code+`"}`))
+			req.Header.Set("Authorization", bearer(t, userID))
+			rec := httptest.NewRecorder()
+			cfg.handlerTwoFactorConfirm(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				if len(f.called("ConfirmTOTP")) != 0 {
+					t.Error("ConfirmTOTP should not run")
+				}
+				return
+			}
+
+			var res recoveryCodesResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || len(res.RecoveryCodes) != recoveryCodeCount {
+				t.Fatalf("response = %+v (%v)", res, err)
+			}
+			// Solo se guardan los hashes
+			stored := f.called("CreateRecoveryCodes")[0][0].(string)
+			for _, c := range res.RecoveryCodes {
+				if strings.Contains(stored, c) || !strings.Contains(stored, auth.HashToken(auth.NormalizeRecoveryCode(c))) {
+					t.Errorf("code %s not stored as a hash: %s", c, stored)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/bootdotdev/learn-http-servers/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+var errEmailNotVerified = errors.New("email not verified")
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// validEmail acepta solo una direccion pelada ("a@b.com"), sin nombre ni <>.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// sendVerificationEmail crea un token de un solo uso para el email actual del
+// usuario y se lo manda. En la DB queda solo el hash.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(cfg.appBaseURL, "/") + "/app/verify?token=" + url.QueryEscape(token)
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email by opening this link within %s:\n\n%s\n\nOr use this code: %s\n",
+			emailVerificationTTL, link, token),
+	})
+}
+
+// checkVerified devuelve errEmailNotVerified si el usuario no verifico su email.
+func (cfg *apiConfig) checkVerified(ctx context.Context, userID uuid.UUID) error {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errEmailNotVerified
+		}
+		return err
+	}
+	if !user.VerifiedAt.Valid {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+// POST /api/users/verify: consume el token del mail
+func (cfg *apiConfig) handlerUsersVerify(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "token required")
+		return
+	}
+
+	dbUser, err := cfg.db.VerifyUserEmail(r.Context(), auth.HashToken(req.Token))
+	if err != nil {
+		// Usado, vencido, inexistente o de un email que ya no es el de la cuenta
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not verify email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		Handle:      dbUser.Handle.String,
+		Role:        dbUser.Role,
+		IsVerified:  dbUser.VerifiedAt.Valid,
+	})
+}
+
+// POST /api/users/verify/resend: manda otro token al usuario logueado
+func (cfg *apiConfig) handlerUsersResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not get user")
+		return
+	}
+	if dbUser.VerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "email already verified")
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not send verification email")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
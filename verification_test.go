@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-http-servers/internal/auth"
+	"github.com/bootdotdev/learn-http-servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// mailedToken saca el token de un mail de verificacion o de reset.
+func mailedToken(t *testing.T, body string) string {
+	t.Helper()
+	_, token, ok := strings.Cut(body, "Or use this code: ")
+	if !ok {
+		t.Fatalf("no token in mail %q", body)
+	}
+	return strings.Fields(token)[0]
+}
+
+func TestHandlerUsersCreateSendsVerification(t *testing.T) {
+	for _, email := range []string{"not-an-email", "Ana <a@example.com>", "a@example.com\nBcc: b@example.com"} {
+		cfg, f := newTestConfig(t)
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"email":`+jsonString(email)+`,"password":"pw"}`))
+		rec := httptest.NewRecorder()
+		cfg.handlerUsersCreate(rec, req)
+		if rec.Code != http.StatusBadRequest || len(f.called("CreateUser")) != 0 {
+			t.Errorf("email %q: status = %d, want 400 without CreateUser", email, rec.Code)
+		}
+	}
+
+	cfg, f := newTestConfig(t)
+	user := database.User{ID: uuid.New(), Email: "a@example.com"}
+	f.returns("CreateUser", userRow(user))
+	f.returns("CreateEmailVerificationToken")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"email":"a@example.com","password":"pw"}`))
+	rec := httptest.NewRecorder()
+	cfg.handlerUsersCreate(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201 (%s)", rec.Code, rec.Body.String())
+	}
+	var res User
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || res.IsVerified {
+		t.Errorf("response = %+v (%v), want unverified user", res, err)
+	}
+
+	sent := cfg.mailer.(*fakeMailer).messages()
+	if len(sent) != 1 || sent[0].To != "a@example.com" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	token := mailedToken(t, sent[0].Body)
+	if !strings.Contains(sent[0].Body, "http://chirpy.test/app/verify?token="+token) {
+		t.Errorf("mail without link: %q", sent[0].Body)
+	}
+	// En la DB solo queda el hash, atado al email de la cuenta
+	args := f.called("CreateEmailVerificationToken")[0]
+	if args[0] != auth.HashToken(token) || args[1] != user.ID.String() || args[2] != "a@example.com" {
+		t.Errorf("CreateEmailVerificationToken args = %v", args)
+	}
+	if exp, _ := args[3].(time.Time); time.Until(exp) < emailVerificationTTL-time.Minute {
+		t.Errorf("expires at %v", args[3])
+	}
+}
+
+func TestHandlerUsersVerify(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "a@example.com", VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true}}
+
+	tests := []struct {
+		name       string
+		body       string
+		found      bool
+		wantStatus int
+	}{
+		{name: "verifies", body: `{"token":"abc"}`, found: true, wantStatus: http.StatusOK},
+		{name: "used or expired", body: `{"token":"abc"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing token", body: `{"token":" "}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			if tc.found {
+				f.returns("VerifyUserEmail", userRow(user))
+			} else {
+				f.returns("VerifyUserEmail")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/verify", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			cfg.handlerUsersVerify(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			calls := f.called("VerifyUserEmail")
+			if tc.body == `{"token":" "}` {
+				if len(calls) != 0 {
+					t.Error("VerifyUserEmail should not run without a token")
+				}
+				return
+			}
+			if calls[0][0] != auth.HashToken("abc") {
+				t.Errorf("VerifyUserEmail arg = %v, want the token hash", calls[0][0])
+			}
+			if tc.found && !strings.Contains(rec.Body.String(), `"is_verified":true`) {
+				t.Errorf("body = %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerUsersUpdateEmailResendsVerification(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	user := database.User{ID: uuid.New(), Email: "new@example.com"}
+	f.returns("UpdateUser", userRow(user))
+	f.returns("CreateEmailVerificationToken")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(`{"email":"new@example.com","password":"pw"}`))
+	req.Header.Set("Authorization", bearer(t, user.ID))
+	rec := httptest.NewRecorder()
+	cfg.handlerUsersUpdate(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	if sent := cfg.mailer.(*fakeMailer).messages(); len(sent) != 1 || sent[0].To != "new@example.com" {
+		t.Errorf("sent = %+v", sent)
+	}
+}
+
+func TestHandlerUsersResendVerification(t *testing.T) {
+	verified := sql.NullTime{Time: time.Now(), Valid: true}
+
+	tests := []struct {
+		name       string
+		verifiedAt sql.NullTime
+		wantStatus int
+		wantMails  int
+	}{
+		{name: "unverified", wantStatus: http.StatusAccepted, wantMails: 1},
+		{name: "already verified", verifiedAt: verified, wantStatus: http.StatusConflict},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, f := newTestConfig(t)
+			user := database.User{ID: uuid.New(), Email: "a@example.com", VerifiedAt: tc.verifiedAt}
+			f.returns("GetUserByID", userRow(user))
+			f.returns("CreateEmailVerificationToken")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users/verify/resend", nil)
+			req.Header.Set("Authorization", bearer(t, user.ID))
+			rec := httptest.NewRecorder()
+			cfg.handlerUsersResendVerification(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			if got := len(cfg.mailer.(*fakeMailer).messages()); got != tc.wantMails {
+				t.Errorf("sent %d mails, want %d", got, tc.wantMails)
+			}
+		})
+	}
+}
+
+func TestUnverifiedUserCannotPost(t *testing.T) {
+	cfg, f := newTestConfig(t)
+	cfg.requireVerifiedEmail = true
+	userID := uuid.New()
+	f.returns("GetUserByID", userRow(database.User{ID: userID, Email: "a@example.com"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hola"}`))
+	req.Header.Set("Authorization", bearer(t, userID))
+	rec := httptest.NewRecorder()
+	cfg.handlerChirps(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 (%s)", rec.Code, rec.Body.String())
+	}
+	if len(f.called("CreateChirp")) != 0 {
+		t.Error("CreateChirp should not run for unverified users")
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}